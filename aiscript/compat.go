@@ -0,0 +1,171 @@
+package aiscript
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mstarongithub/mk-plugin-repo/config"
+)
+
+// How the AiScript version a plugin version targets relates to the known AiScript releases
+type Compatibility string
+
+const (
+	COMPAT_COMPATIBLE Compatibility = "compatible" // Targets a known release that isn't legacy
+	COMPAT_LEGACY     Compatibility = "legacy"     // Targets a known release with outdated syntax
+	COMPAT_UNKNOWN    Compatibility = "unknown"    // Targets no AiScript version or one that isn't known
+)
+
+// An AiScript release and the first Misskey release shipping it
+type Release struct {
+	Version string // Like "0.19.0"
+	Misskey string // Like "2024.8.0"
+}
+
+// Releases known if the config doesn't list any, oldest first
+var DefaultReleases = []Release{
+	{Version: "0.11.1", Misskey: "12.0.0"},
+	{Version: "0.12.4", Misskey: "13.0.0"},
+	{Version: "0.13.3", Misskey: "13.10.0"},
+	{Version: "0.14.1", Misskey: "13.13.0"},
+	{Version: "0.15.0", Misskey: "2023.9.0"},
+	{Version: "0.16.0", Misskey: "2023.10.0"},
+	{Version: "0.17.0", Misskey: "2024.2.0"},
+	{Version: "0.18.0", Misskey: "2024.5.0"},
+	{Version: "0.19.0", Misskey: "2024.8.0"},
+}
+
+// Releases before this one are legacy if the config doesn't say otherwise. Their syntax is outdated
+const DEFAULT_LEGACY_BEFORE = "0.17.0"
+
+// The known releases, from the config or the defaults, oldest first
+// Releases with unparsable versions are left out
+func Releases() []Release {
+	releases := DefaultReleases
+	if config.GlobalConfig != nil && len(config.GlobalConfig.AiScript.Releases) > 0 {
+		releases = make([]Release, 0, len(config.GlobalConfig.AiScript.Releases))
+		for _, release := range config.GlobalConfig.AiScript.Releases {
+			releases = append(releases, Release{Version: release.Version, Misskey: release.Misskey})
+		}
+	}
+	releases = slices.DeleteFunc(slices.Clone(releases), func(release Release) bool {
+		_, versionOk := parseVersion(release.Version)
+		_, misskeyOk := parseVersion(release.Misskey)
+		return !versionOk || !misskeyOk
+	})
+	slices.SortStableFunc(releases, func(a, b Release) int {
+		return compareVersions(a.Version, b.Version)
+	})
+	return releases
+}
+
+func legacyBefore() string {
+	if config.GlobalConfig != nil && config.GlobalConfig.AiScript.LegacyBefore != "" {
+		return config.GlobalConfig.AiScript.LegacyBefore
+	}
+	return DEFAULT_LEGACY_BEFORE
+}
+
+// Classify the AiScript version a plugin version targets
+// It is known if it is in the same release line as a known release (same minor version for 0.x, same major otherwise)
+func Classify(target string) Compatibility {
+	targetParts, ok := parseVersion(target)
+	if !ok {
+		return COMPAT_UNKNOWN
+	}
+	known := slices.ContainsFunc(Releases(), func(release Release) bool {
+		releaseParts, _ := parseVersion(release.Version)
+		return sameLine(targetParts, releaseParts)
+	})
+	if !known {
+		return COMPAT_UNKNOWN
+	}
+	if compareVersions(target, legacyBefore()) < 0 {
+		return COMPAT_LEGACY
+	}
+	return COMPAT_COMPATIBLE
+}
+
+// Get the AiScript version a Misskey version ships: that of the newest release it includes
+// Returns false if the Misskey version can't be parsed or is older than all known releases
+func ForMisskey(misskeyVersion string) (string, bool) {
+	if _, ok := parseVersion(misskeyVersion); !ok {
+		return "", false
+	}
+	found := ""
+	for _, release := range Releases() {
+		if compareVersions(release.Misskey, misskeyVersion) <= 0 &&
+			(found == "" || compareVersions(release.Version, found) > 0) {
+			found = release.Version
+		}
+	}
+	return found, found != ""
+}
+
+// Whether the string is an AiScript version, like "0.19.0"
+func IsVersion(version string) bool {
+	_, ok := parseVersion(version)
+	return ok
+}
+
+// Whether code written for the target AiScript version is known to run on the runtime version
+// Code targeting unknown versions doesn't. If the runtime is empty, everything runs
+func RunsOn(target, runtime string) bool {
+	if runtime == "" {
+		return true
+	}
+	return Classify(target) != COMPAT_UNKNOWN && IsCompatible(target, runtime)
+}
+
+// Whether code written for the target AiScript version runs on the runtime version
+// Versions are compatible if the runtime is at least as new and has the same major version,
+// or the same minor version while the major version is 0, since AiScript breaks things in those.
+// If either version is empty or can't be parsed, compatibility can't be told and is assumed
+func IsCompatible(target, runtime string) bool {
+	targetParts, ok := parseVersion(target)
+	if !ok {
+		return true
+	}
+	runtimeParts, ok := parseVersion(runtime)
+	if !ok {
+		return true
+	}
+	return sameLine(targetParts, runtimeParts) && compareParts(targetParts, runtimeParts) <= 0
+}
+
+// Whether two versions are of the same release line, between which nothing breaks
+func sameLine(a, b [3]int) bool {
+	return a[0] == b[0] && (a[0] != 0 || a[1] == b[1])
+}
+
+// Compare two versions by major, minor and patch. Unparsable versions count as 0.0.0
+func compareVersions(a, b string) int {
+	aParts, _ := parseVersion(a)
+	bParts, _ := parseVersion(b)
+	return compareParts(aParts, bParts)
+}
+
+func compareParts(a, b [3]int) int {
+	return slices.Compare(a[:], b[:])
+}
+
+// Get major, minor and patch of a version like "0.19.0". A prerelease or build suffix is ignored
+// Missing minor or patch versions count as 0
+func parseVersion(version string) ([3]int, bool) {
+	parts := [3]int{}
+	version, _, _ = strings.Cut(version, "-")
+	version, _, _ = strings.Cut(version, "+")
+	fields := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if version == "" || len(fields) > len(parts) {
+		return parts, false
+	}
+	for i, field := range fields {
+		number, err := strconv.Atoi(field)
+		if err != nil || number < 0 {
+			return parts, false
+		}
+		parts[i] = number
+	}
+	return parts, true
+}
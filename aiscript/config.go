@@ -0,0 +1,78 @@
+package aiscript
+
+import "fmt"
+
+// Types of config settings Misskey renders for plugins
+const (
+	CONFIG_TYPE_STRING  = "string"
+	CONFIG_TYPE_NUMBER  = "number"
+	CONFIG_TYPE_BOOLEAN = "boolean"
+)
+
+// A setting declared in the config block of the metadata header, like
+// "greeting: { type: "string", label: "Greeting", description: "...", default: "hi" }"
+type ConfigField struct {
+	Key         string `json:"key"`             // Name the code reads the setting by
+	Type        string `json:"type"`            // Type of the setting. Usually one of the CONFIG_TYPE_ constants
+	Label       string `json:"label,omitempty"` // Label Misskey shows for the setting
+	Description string `json:"description,omitempty"`
+	Default     any    `json:"default,omitempty"` // Value used until the user changes it. Nil if none is declared
+}
+
+// Get the settings declared in a config block, in declaration order
+// Returns an error wrapping ErrBadMetadataField if a setting isn't an object with a string type,
+// its label or description aren't strings or its default doesn't match a known type
+func ParseConfigFields(config *Object) ([]ConfigField, error) {
+	if config == nil {
+		return nil, nil
+	}
+	fields := make([]ConfigField, 0, len(config.Keys))
+	for _, key := range config.Keys {
+		definition, isObject := config.Values[key].(*Object)
+		if !isObject {
+			return nil, fmt.Errorf("%w: config.%s must be an object", ErrBadMetadataField, key)
+		}
+		field := ConfigField{Key: key}
+		stringFields := map[string]*string{
+			"type":        &field.Type,
+			"label":       &field.Label,
+			"description": &field.Description,
+		}
+		for _, name := range []string{"type", "label", "description"} {
+			value, ok := definition.Get(name)
+			if !ok || value == nil {
+				continue
+			}
+			text, isString := value.(string)
+			if !isString {
+				return nil, fmt.Errorf("%w: config.%s.%s must be a string", ErrBadMetadataField, key, name)
+			}
+			*stringFields[name] = text
+		}
+		if field.Type == "" {
+			return nil, fmt.Errorf("%w: config.%s has no type", ErrBadMetadataField, key)
+		}
+		field.Default, _ = definition.Get("default")
+		if field.Default != nil && !defaultMatchesType(field.Default, field.Type) {
+			return nil, fmt.Errorf("%w: default of config.%s must be a %s", ErrBadMetadataField, key, field.Type)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// Whether a default value fits the declared type. Defaults of unknown types are taken as they are
+func defaultMatchesType(value any, configType string) bool {
+	var ok bool
+	switch configType {
+	case CONFIG_TYPE_STRING:
+		_, ok = value.(string)
+	case CONFIG_TYPE_NUMBER:
+		_, ok = value.(float64)
+	case CONFIG_TYPE_BOOLEAN:
+		_, ok = value.(bool)
+	default:
+		ok = true
+	}
+	return ok
+}
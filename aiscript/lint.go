@@ -0,0 +1,253 @@
+package aiscript
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// How much attention a lint finding needs from a reviewer
+type Severity string
+
+const (
+	SEVERITY_INFO    Severity = "info"    // Worth knowing, but usually fine
+	SEVERITY_WARNING Severity = "warning" // Should be checked by hand
+	SEVERITY_DANGER  Severity = "danger"  // Likely harmful or broken
+)
+
+// All severities, from least to most severe
+var Severities = []Severity{SEVERITY_INFO, SEVERITY_WARNING, SEVERITY_DANGER}
+
+// Rules the linter checks
+const (
+	LINT_UNPARSABLE            = "unparsable"            // The code couldn't be tokenised. Only the part before the problem is checked
+	LINT_ADMIN_API             = "admin-api"             // Mk:api calls an admin endpoint
+	LINT_DYNAMIC_API           = "dynamic-api"           // Mk:api calls an endpoint that isn't a literal, so it can't be checked
+	LINT_UNDECLARED_PERMISSION = "undeclared-permission" // Mk:api calls an endpoint needing a permission the metadata doesn't request
+	LINT_PERSISTENCE           = "persistence"           // Data is stored on the user's device via Mk:save
+	LINT_NETWORK_LITERAL       = "network-literal"       // A string contains a url
+	LINT_LONG_LINE             = "long-line"             // A line is unusually long, which is typical for minified or obfuscated code
+	LINT_ENCODED_BLOB          = "encoded-blob"          // A string contains a long base64 or hex encoded blob
+)
+
+// Lines longer than this many characters are flagged
+const MAX_LINE_LENGTH = 500
+
+// Encoded blobs at least this many characters long are flagged
+const MIN_BLOB_LENGTH = 200
+
+// At most this many findings are reported per version
+const MAX_LINT_FINDINGS = 200
+
+// A potential problem the linter found in AiScript code
+type Finding struct {
+	Rule     string   `json:"rule"`     // The rule that found it. One of the LINT_ constants
+	Severity Severity `json:"severity"` // How much attention it needs
+	Line     int      `json:"line"`     // Line of the problem, starting at 1
+	Column   int      `json:"column"`   // Column of the problem in characters, starting at 1
+	Message  string   `json:"message"`  // What was found
+}
+
+// An API endpoint, or all endpoints under a path if it ends with "/", and the permission it needs
+type endpointPermission struct {
+	endpoint   string
+	permission string
+}
+
+// Permissions needed by the Misskey API endpoints plugins commonly call
+// Endpoints not listed here aren't checked. The longest match wins
+var endpointPermissions = []endpointPermission{
+	{"i", "read:account"},
+	{"i/update", "write:account"},
+	{"i/favorites", "read:favorites"},
+	{"i/notifications", "read:notifications"},
+	{"notifications/mark-all-as-read", "write:notifications"},
+	{"notes/create", "write:notes"},
+	{"notes/delete", "write:notes"},
+	{"notes/update", "write:notes"},
+	{"notes/reactions/create", "write:reactions"},
+	{"notes/reactions/delete", "write:reactions"},
+	{"notes/favorites/create", "write:favorites"},
+	{"notes/favorites/delete", "write:favorites"},
+	{"notes/polls/vote", "write:votes"},
+	{"following/create", "write:following"},
+	{"following/delete", "write:following"},
+	{"following/update", "write:following"},
+	{"following/requests/accept", "write:following"},
+	{"following/requests/reject", "write:following"},
+	{"blocking/create", "write:blocks"},
+	{"blocking/delete", "write:blocks"},
+	{"blocking/list", "read:blocks"},
+	{"mute/create", "write:mutes"},
+	{"mute/delete", "write:mutes"},
+	{"mute/list", "read:mutes"},
+	{"drive/", "read:drive"},
+	{"drive/files/create", "write:drive"},
+	{"drive/files/delete", "write:drive"},
+	{"drive/files/update", "write:drive"},
+	{"drive/folders/create", "write:drive"},
+	{"drive/folders/delete", "write:drive"},
+	{"drive/folders/update", "write:drive"},
+	{"pages/create", "write:pages"},
+	{"pages/delete", "write:pages"},
+	{"pages/update", "write:pages"},
+	{"pages/like", "write:page-likes"},
+	{"pages/unlike", "write:page-likes"},
+	{"channels/follow", "write:channels"},
+	{"channels/unfollow", "write:channels"},
+}
+
+var urlRegex = regexp.MustCompile(`(?i)\b(?:https?|wss?|ftp)://[^\s"'` + "`" + `]+`)
+var blobRegex = regexp.MustCompile(fmt.Sprintf(`[A-Za-z0-9+/_-]{%d,}={0,2}`, MIN_BLOB_LENGTH))
+
+// Check AiScript code for patterns reviewers should look at
+// meta is the metadata parsed from the code and may be nil. Findings are ordered by position
+func Lint(code string, meta *Metadata) []Finding {
+	findings := []Finding{}
+	add := func(rule string, severity Severity, line, column int, format string, args ...any) {
+		findings = append(findings, Finding{
+			Rule:     rule,
+			Severity: severity,
+			Line:     line,
+			Column:   column,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	for i, line := range strings.Split(code, "\n") {
+		if length := utf8.RuneCountInString(line); length > MAX_LINE_LENGTH {
+			add(LINT_LONG_LINE, SEVERITY_WARNING, i+1, 1, "line is %d characters long", length)
+		}
+	}
+
+	tokens, err := Tokenize(code)
+	if syntaxErr, ok := err.(*SyntaxError); ok {
+		add(LINT_UNPARSABLE, SEVERITY_WARNING, syntaxErr.Line, syntaxErr.Column, "%s", syntaxErr.Message)
+	}
+	var permissions []string
+	if meta != nil {
+		permissions = meta.Permissions
+	}
+	// Strings in the metadata header describe the plugin and are shown to users anyways
+	inHeader := false
+	headerDepth := 0
+	for i, token := range tokens {
+		if token.Kind == TOKEN_PUNCT && token.Text == "###" && headerDepth == 0 {
+			inHeader = true
+			continue
+		}
+		if inHeader && token.Kind == TOKEN_PUNCT {
+			switch token.Text {
+			case "{":
+				headerDepth++
+			case "}":
+				headerDepth--
+				inHeader = headerDepth > 0
+			}
+		}
+
+		switch token.Kind {
+		case TOKEN_STRING, TOKEN_TEMPLATE:
+			if match := blobRegex.FindString(token.Text); match != "" {
+				add(LINT_ENCODED_BLOB, SEVERITY_WARNING, token.Line, token.Column,
+					"string contains an encoded blob of %d characters", len(match))
+			}
+			if inHeader {
+				continue
+			}
+			for _, match := range urlRegex.FindAllString(token.Text, -1) {
+				add(LINT_NETWORK_LITERAL, SEVERITY_INFO, token.Line, token.Column, "string contains the url %q", match)
+			}
+		case TOKEN_IDENT:
+			if i+1 >= len(tokens) || tokens[i+1].Kind != TOKEN_PUNCT || tokens[i+1].Text != "(" {
+				continue
+			}
+			switch token.Text {
+			case "Mk:save":
+				add(LINT_PERSISTENCE, SEVERITY_INFO, token.Line, token.Column,
+					"stores data on the user's device with Mk:save")
+			case "Mk:api":
+				lintApiCall(tokens[i+2:], token, permissions, add)
+			}
+		}
+	}
+
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+	if len(findings) > MAX_LINT_FINDINGS {
+		findings = findings[:MAX_LINT_FINDINGS]
+	}
+	return findings
+}
+
+// Check a call to Mk:api. args are the tokens after the opening bracket
+func lintApiCall(
+	args []Token,
+	call Token,
+	permissions []string,
+	add func(rule string, severity Severity, line, column int, format string, args ...any),
+) {
+	endpoint, ok := literalArgument(args)
+	if !ok {
+		add(LINT_DYNAMIC_API, SEVERITY_WARNING, call.Line, call.Column,
+			"Mk:api is called with an endpoint that isn't a string literal")
+		return
+	}
+	endpoint = strings.Trim(endpoint, "/ ")
+	if strings.HasPrefix(endpoint, "admin/") {
+		add(LINT_ADMIN_API, SEVERITY_DANGER, call.Line, call.Column, "calls the admin endpoint %q", endpoint)
+		if !slices.ContainsFunc(permissions, func(p string) bool { return strings.Contains(p, "admin") }) {
+			add(LINT_UNDECLARED_PERMISSION, SEVERITY_DANGER, call.Line, call.Column,
+				"calls the admin endpoint %q, but requests no admin permission", endpoint)
+		}
+		return
+	}
+	if needed := permissionFor(endpoint); needed != "" && !slices.Contains(permissions, needed) {
+		add(LINT_UNDECLARED_PERMISSION, SEVERITY_DANGER, call.Line, call.Column,
+			"calls %q, which needs the permission %q the metadata doesn't request", endpoint, needed)
+	}
+}
+
+// Get the value of an argument if it is a string literal, including template strings without expressions
+func literalArgument(args []Token) (string, bool) {
+	if len(args) > 0 && args[0].Kind == TOKEN_STRING {
+		return args[0].Text, true
+	}
+	if len(args) >= 2 && args[0].Text == "`" && args[1].Text == "`" {
+		return "", true
+	}
+	if len(args) >= 3 && args[0].Text == "`" && args[1].Kind == TOKEN_TEMPLATE && args[2].Text == "`" {
+		return args[1].Text, true
+	}
+	return "", false
+}
+
+// Get the permission an endpoint needs. Empty if it isn't known
+func permissionFor(endpoint string) string {
+	best := endpointPermission{}
+	for _, entry := range endpointPermissions {
+		matches := entry.endpoint == endpoint ||
+			(strings.HasSuffix(entry.endpoint, "/") && strings.HasPrefix(endpoint, entry.endpoint))
+		if matches && len(entry.endpoint) > len(best.endpoint) {
+			best = entry
+		}
+	}
+	return best.permission
+}
+
+// Get the most severe severity of some findings. Empty if there are none
+func HighestSeverity(findings []Finding) Severity {
+	highest := Severity("")
+	for _, finding := range findings {
+		if slices.Index(Severities, finding.Severity) > slices.Index(Severities, highest) {
+			highest = finding.Severity
+		}
+	}
+	return highest
+}
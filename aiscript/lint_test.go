@@ -0,0 +1,270 @@
+package aiscript
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLintRules(t *testing.T) {
+	blob := strings.Repeat("QUJD", MIN_BLOB_LENGTH/4)
+	tests := []struct {
+		name        string
+		code        string
+		permissions []string
+		rule        string
+		want        bool
+	}{
+		{"unparsable code", `let a = "x`, nil, LINT_UNPARSABLE, true},
+		{"parsable code", `let a = "x"`, nil, LINT_UNPARSABLE, false},
+
+		{"admin endpoint", `Mk:api("admin/suspend-user", { userId: "x" })`, []string{"write:admin:suspend-user"}, LINT_ADMIN_API, true},
+		{"admin endpoint with slashes", `Mk:api("/admin/meta/", {})`, nil, LINT_ADMIN_API, true},
+		{"regular endpoint", `Mk:api("notes/create", {})`, []string{"write:notes"}, LINT_ADMIN_API, false},
+		{"admin endpoint outside of a call", `let e = "admin/suspend-user"`, nil, LINT_ADMIN_API, false},
+
+		{"endpoint from a variable", `let e = "i"` + "\n" + `Mk:api(e, {})`, nil, LINT_DYNAMIC_API, true},
+		{"endpoint from a template expression", "Mk:api(`notes/{action}`, {})", nil, LINT_DYNAMIC_API, true},
+		{"endpoint as string", `Mk:api("i", {})`, []string{"read:account"}, LINT_DYNAMIC_API, false},
+		{"endpoint as plain template", "Mk:api(`i`, {})", []string{"read:account"}, LINT_DYNAMIC_API, false},
+
+		{"missing permission", `Mk:api("notes/create", {})`, nil, LINT_UNDECLARED_PERMISSION, true},
+		{"other permission declared", `Mk:api("notes/create", {})`, []string{"read:account"}, LINT_UNDECLARED_PERMISSION, true},
+		{"missing permission in template", "Mk:api(`notes/create`, {})", nil, LINT_UNDECLARED_PERMISSION, true},
+		{"missing permission by prefix", `Mk:api("drive/files", {})`, nil, LINT_UNDECLARED_PERMISSION, true},
+		{"admin endpoint without admin permission", `Mk:api("admin/meta", {})`, []string{"read:account"}, LINT_UNDECLARED_PERMISSION, true},
+		{"declared permission", `Mk:api("notes/create", {})`, []string{"write:notes"}, LINT_UNDECLARED_PERMISSION, false},
+		{"declared permission by prefix", `Mk:api("drive/stream", {})`, []string{"read:drive"}, LINT_UNDECLARED_PERMISSION, false},
+		{"admin endpoint with admin permission", `Mk:api("admin/meta", {})`, []string{"read:admin:meta"}, LINT_UNDECLARED_PERMISSION, false},
+		{"unknown endpoint", `Mk:api("charts/active-users", {})`, nil, LINT_UNDECLARED_PERMISSION, false},
+
+		{"Mk:save call", `Mk:save("key", 1)`, nil, LINT_PERSISTENCE, true},
+		{"Mk:load call", `Mk:load("key")`, nil, LINT_PERSISTENCE, false},
+		{"Mk:save not called", `let save = Mk:save`, nil, LINT_PERSISTENCE, false},
+
+		{"url in a string", `let u = "https://example.com/x"`, nil, LINT_NETWORK_LITERAL, true},
+		{"url in a template", "let u = `wss://example.com/{path}`", nil, LINT_NETWORK_LITERAL, true},
+		{"url in a comment", "// see https://example.com\nlet a = 1", nil, LINT_NETWORK_LITERAL, false},
+		{"url in the metadata header", "### {\n\tname: \"x\"\n\tdescription: \"https://example.com\"\n}", nil, LINT_NETWORK_LITERAL, false},
+		{"url after the metadata header", "### { name: \"x\" }\nlet u = \"https://example.com\"", nil, LINT_NETWORK_LITERAL, true},
+		{"url after a header with nested objects", "### { config: { a: { type: \"string\" } } }\nlet u = \"http://x.y\"", nil, LINT_NETWORK_LITERAL, true},
+
+		{"long line", "let a = \"" + strings.Repeat("a b ", MAX_LINE_LENGTH/4) + "\"", nil, LINT_LONG_LINE, true},
+		{"line at the limit", strings.Repeat("a", MAX_LINE_LENGTH), nil, LINT_LONG_LINE, false},
+		{"long line of multi byte characters at the limit", "<: \"" + strings.Repeat("ü", MAX_LINE_LENGTH-5) + "\"", nil, LINT_LONG_LINE, false},
+
+		{"encoded blob", `let b = "` + blob + `"`, nil, LINT_ENCODED_BLOB, true},
+		{"encoded blob in the metadata header", `### { description: "` + blob + `" }`, nil, LINT_ENCODED_BLOB, true},
+		{"short encoded string", `let b = "` + blob[:MIN_BLOB_LENGTH-1] + `"`, nil, LINT_ENCODED_BLOB, false},
+		{"blob in a comment", "// " + blob + "\nlet a = 1", nil, LINT_ENCODED_BLOB, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			findings := Lint(test.code, &Metadata{Permissions: test.permissions})
+			found := slices.ContainsFunc(findings, func(finding Finding) bool { return finding.Rule == test.rule })
+			if found != test.want {
+				t.Errorf("Lint() = %+v, want a %q finding: %v", findings, test.rule, test.want)
+			}
+		})
+	}
+}
+
+func TestLintWithoutMetadata(t *testing.T) {
+	findings := Lint(`Mk:api("notes/create", {})`, nil)
+	if len(findings) != 1 || findings[0].Rule != LINT_UNDECLARED_PERMISSION {
+		t.Errorf("Lint() = %+v, want a single %q finding", findings, LINT_UNDECLARED_PERMISSION)
+	}
+}
+
+func TestLintFindingPositionsAndOrder(t *testing.T) {
+	code := "let u = \"https://example.com\"\n\n  Mk:save(\"k\", 1); Mk:api(\"admin/meta\", {})"
+	findings := Lint(code, nil)
+	want := []Finding{
+		{Rule: LINT_NETWORK_LITERAL, Severity: SEVERITY_INFO, Line: 1, Column: 9},
+		{Rule: LINT_PERSISTENCE, Severity: SEVERITY_INFO, Line: 3, Column: 3},
+		{Rule: LINT_ADMIN_API, Severity: SEVERITY_DANGER, Line: 3, Column: 20},
+		{Rule: LINT_UNDECLARED_PERMISSION, Severity: SEVERITY_DANGER, Line: 3, Column: 20},
+	}
+	if len(findings) != len(want) {
+		t.Fatalf("Lint() = %+v, want %d findings", findings, len(want))
+	}
+	for i, finding := range findings {
+		finding.Message = ""
+		if finding != want[i] {
+			t.Errorf("finding %d = %+v, want %+v", i, finding, want[i])
+		}
+	}
+}
+
+func TestLintLimitsFindings(t *testing.T) {
+	code := strings.Repeat("Mk:save(\"k\", 1)\n", MAX_LINT_FINDINGS+10)
+	if findings := Lint(code, nil); len(findings) != MAX_LINT_FINDINGS {
+		t.Errorf("Lint() returned %d findings, want %d", len(findings), MAX_LINT_FINDINGS)
+	}
+}
+
+func TestPermissionFor(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"i", "read:account"},
+		{"i/update", "write:account"},
+		{"drive/files", "read:drive"},
+		{"drive/files/create", "write:drive"},
+		{"notes/show", ""},
+		{"iframe", ""},
+	}
+	for _, test := range tests {
+		if got := permissionFor(test.endpoint); got != test.want {
+			t.Errorf("permissionFor(%q) = %q, want %q", test.endpoint, got, test.want)
+		}
+	}
+}
+
+func TestHighestSeverity(t *testing.T) {
+	tests := []struct {
+		severities []Severity
+		want       Severity
+	}{
+		{nil, ""},
+		{[]Severity{SEVERITY_INFO}, SEVERITY_INFO},
+		{[]Severity{SEVERITY_INFO, SEVERITY_DANGER, SEVERITY_WARNING}, SEVERITY_DANGER},
+		{[]Severity{SEVERITY_WARNING, SEVERITY_INFO}, SEVERITY_WARNING},
+	}
+	for _, test := range tests {
+		findings := []Finding{}
+		for _, severity := range test.severities {
+			findings = append(findings, Finding{Severity: severity})
+		}
+		if got := HighestSeverity(findings); got != test.want {
+			t.Errorf("HighestSeverity(%v) = %q, want %q", test.severities, got, test.want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want []Token
+	}{
+		{"empty", "", []Token{}},
+		{
+			"statement",
+			"let a = 1.5",
+			[]Token{
+				{Kind: TOKEN_IDENT, Text: "let", Line: 1, Column: 1},
+				{Kind: TOKEN_IDENT, Text: "a", Line: 1, Column: 5},
+				{Kind: TOKEN_PUNCT, Text: "=", Line: 1, Column: 7},
+				{Kind: TOKEN_NUMBER, Text: "1.5", Line: 1, Column: 9},
+			},
+		},
+		{
+			"comments are dropped and line breaks recorded",
+			"a // one\n/* two\n */ b",
+			[]Token{
+				{Kind: TOKEN_IDENT, Text: "a", Line: 1, Column: 1},
+				{Kind: TOKEN_IDENT, Text: "b", Line: 3, Column: 5, NewlineBefore: true},
+			},
+		},
+		{
+			"strings",
+			`"a\"b" 'c'`,
+			[]Token{
+				{Kind: TOKEN_STRING, Text: `a"b`, Line: 1, Column: 1},
+				{Kind: TOKEN_STRING, Text: "c", Line: 1, Column: 8},
+			},
+		},
+		{
+			"namespaced names",
+			"Mk:api util:x a : b",
+			[]Token{
+				{Kind: TOKEN_IDENT, Text: "Mk:api", Line: 1, Column: 1},
+				{Kind: TOKEN_IDENT, Text: "util:x", Line: 1, Column: 8},
+				{Kind: TOKEN_IDENT, Text: "a", Line: 1, Column: 15},
+				{Kind: TOKEN_PUNCT, Text: ":", Line: 1, Column: 17},
+				{Kind: TOKEN_IDENT, Text: "b", Line: 1, Column: 19},
+			},
+		},
+		{
+			"operators",
+			"### <: => == && :: +=",
+			[]Token{
+				{Kind: TOKEN_PUNCT, Text: "###", Line: 1, Column: 1},
+				{Kind: TOKEN_PUNCT, Text: "<:", Line: 1, Column: 5},
+				{Kind: TOKEN_PUNCT, Text: "=>", Line: 1, Column: 8},
+				{Kind: TOKEN_PUNCT, Text: "==", Line: 1, Column: 11},
+				{Kind: TOKEN_PUNCT, Text: "&&", Line: 1, Column: 14},
+				{Kind: TOKEN_PUNCT, Text: "::", Line: 1, Column: 17},
+				{Kind: TOKEN_PUNCT, Text: "+=", Line: 1, Column: 20},
+			},
+		},
+		{
+			"template with expression",
+			"`a{ {b: 1}.b }c`",
+			[]Token{
+				{Kind: TOKEN_PUNCT, Text: "`", Line: 1, Column: 1},
+				{Kind: TOKEN_TEMPLATE, Text: "a", Line: 1, Column: 2},
+				{Kind: TOKEN_PUNCT, Text: "{", Line: 1, Column: 3},
+				{Kind: TOKEN_PUNCT, Text: "{", Line: 1, Column: 5},
+				{Kind: TOKEN_IDENT, Text: "b", Line: 1, Column: 6},
+				{Kind: TOKEN_PUNCT, Text: ":", Line: 1, Column: 7},
+				{Kind: TOKEN_NUMBER, Text: "1", Line: 1, Column: 9},
+				{Kind: TOKEN_PUNCT, Text: "}", Line: 1, Column: 10},
+				{Kind: TOKEN_PUNCT, Text: ".", Line: 1, Column: 11},
+				{Kind: TOKEN_IDENT, Text: "b", Line: 1, Column: 12},
+				{Kind: TOKEN_PUNCT, Text: "}", Line: 1, Column: 14},
+				{Kind: TOKEN_TEMPLATE, Text: "c", Line: 1, Column: 15},
+				{Kind: TOKEN_PUNCT, Text: "`", Line: 1, Column: 16},
+			},
+		},
+		{
+			"columns count characters",
+			`"ä" x`,
+			[]Token{
+				{Kind: TOKEN_STRING, Text: "ä", Line: 1, Column: 1},
+				{Kind: TOKEN_IDENT, Text: "x", Line: 1, Column: 5},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Tokenize(test.code)
+			if err != nil {
+				t.Fatalf("Tokenize() error = %v", err)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("Tokenize() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTokenizeErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       string
+		line       int
+		column     int
+		tokensKept int
+	}{
+		{"unterminated string", "a\n  \"b", 2, 3, 1},
+		{"unterminated template", "a `b{c}", 1, 8, 6},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens, err := Tokenize(test.code)
+			syntaxErr, ok := err.(*SyntaxError)
+			if !ok {
+				t.Fatalf("Tokenize() error = %v, want a *SyntaxError", err)
+			}
+			if syntaxErr.Line != test.line || syntaxErr.Column != test.column {
+				t.Errorf("position = %d:%d, want %d:%d", syntaxErr.Line, syntaxErr.Column, test.line, test.column)
+			}
+			if len(tokens) != test.tokensKept {
+				t.Errorf("Tokenize() returned %d tokens, want the %d before the problem", len(tokens), test.tokensKept)
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package aiscript
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// An AiScript object literal. Keeps the order the keys were declared in
+type Object struct {
+	Keys   []string       // Keys in declaration order
+	Values map[string]any // Values by key
+}
+
+// Get the value for a key and whether the object has it
+func (o *Object) Get(key string) (any, bool) {
+	if o == nil {
+		return nil, false
+	}
+	v, ok := o.Values[key]
+	return v, ok
+}
+
+// Marshal the object into a json object with the keys in declaration order
+func (o *Object) MarshalJSON() ([]byte, error) {
+	if o == nil {
+		return []byte("null"), nil
+	}
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, key := range o.Keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(o.Values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Parser for AiScript literals: strings, numbers, booleans, null, arrays and objects
+// Strings become string, numbers float64, null nil, arrays []any and objects *Object
+type literalParser struct {
+	src    []rune
+	pos    int
+	line   int
+	column int
+}
+
+func newLiteralParser(src string) *literalParser {
+	return &literalParser{src: []rune(src), line: 1, column: 1}
+}
+
+// Move the parser to the given byte offset in the source
+func (p *literalParser) seek(offset int) {
+	for _, r := range string(p.src)[:offset] {
+		p.advanceOver(r)
+	}
+}
+
+func (p *literalParser) errorf(format string, args ...any) *SyntaxError {
+	return &SyntaxError{Line: p.line, Column: p.column, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *literalParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *literalParser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *literalParser) next() rune {
+	r := p.src[p.pos]
+	p.advanceOver(r)
+	return r
+}
+
+func (p *literalParser) advanceOver(r rune) {
+	p.pos++
+	if r == '\n' {
+		p.line++
+		p.column = 1
+	} else {
+		p.column++
+	}
+}
+
+// Skip spaces and comments. Newlines are only skipped if skipNewlines is set
+// Returns whether a newline was skipped
+func (p *literalParser) skipSpace(skipNewlines bool) bool {
+	sawNewline := false
+	for !p.eof() {
+		r := p.peek()
+		switch {
+		case r == '\n':
+			if !skipNewlines {
+				return sawNewline
+			}
+			sawNewline = true
+			p.next()
+		case unicode.IsSpace(r):
+			p.next()
+		case r == '/' && p.pos+1 < len(p.src) && p.src[p.pos+1] == '/':
+			for !p.eof() && p.peek() != '\n' {
+				p.next()
+			}
+		case r == '/' && p.pos+1 < len(p.src) && p.src[p.pos+1] == '*':
+			p.next()
+			p.next()
+			for !p.eof() && !(p.peek() == '*' && p.pos+1 < len(p.src) && p.src[p.pos+1] == '/') {
+				p.next()
+			}
+			if !p.eof() {
+				p.next()
+				p.next()
+			}
+		default:
+			return sawNewline
+		}
+	}
+	return sawNewline
+}
+
+func (p *literalParser) parseValue() (any, error) {
+	p.skipSpace(true)
+	if p.eof() {
+		return nil, p.errorf("unexpected end of code, expected a value")
+	}
+	switch r := p.peek(); {
+	case r == '"' || r == '\'' || r == '`':
+		return p.parseString()
+	case r == '[':
+		return p.parseArray()
+	case r == '{':
+		return p.parseObject()
+	case r == '-' || unicode.IsDigit(r):
+		return p.parseNumber()
+	case isIdentStart(r):
+		line, column := p.line, p.column
+		switch ident := p.parseIdent(); ident {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		default:
+			return nil, &SyntaxError{
+				Line:    line,
+				Column:  column,
+				Message: fmt.Sprintf("expected a literal value, got %q", ident),
+			}
+		}
+	default:
+		return nil, p.errorf("unexpected character %q, expected a value", r)
+	}
+}
+
+func (p *literalParser) parseString() (string, error) {
+	quote := p.next()
+	builder := strings.Builder{}
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		r := p.next()
+		switch {
+		case r == quote:
+			return builder.String(), nil
+		case r == '\\':
+			if p.eof() {
+				return "", p.errorf("unterminated string")
+			}
+			builder.WriteRune(p.next())
+		case quote == '`' && r == '{':
+			return "", p.errorf("template expressions are not allowed in literals")
+		default:
+			builder.WriteRune(r)
+		}
+	}
+}
+
+func (p *literalParser) parseNumber() (float64, error) {
+	start := p.pos
+	line, column := p.line, p.column
+	if p.peek() == '-' {
+		p.next()
+	}
+	for !p.eof() && (unicode.IsDigit(p.peek()) || p.peek() == '.') {
+		p.next()
+	}
+	text := string(p.src[start:p.pos])
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, &SyntaxError{Line: line, Column: column, Message: fmt.Sprintf("invalid number %q", text)}
+	}
+	return n, nil
+}
+
+func (p *literalParser) parseIdent() string {
+	start := p.pos
+	for !p.eof() && isIdentPart(p.peek()) {
+		p.next()
+	}
+	return string(p.src[start:p.pos])
+}
+
+func (p *literalParser) parseArray() ([]any, error) {
+	p.next()
+	values := []any{}
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array, expected ]")
+		}
+		if p.peek() == ']' {
+			p.next()
+			return values, nil
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		if err = p.parseSeparator(']', ','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *literalParser) parseObject() (*Object, error) {
+	p.next()
+	obj := &Object{Keys: []string{}, Values: map[string]any{}}
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated object, expected }")
+		}
+		if p.peek() == '}' {
+			p.next()
+			return obj, nil
+		}
+		line, column := p.line, p.column
+		var key string
+		switch r := p.peek(); {
+		case r == '"' || r == '\'':
+			var err error
+			if key, err = p.parseString(); err != nil {
+				return nil, err
+			}
+		case isIdentStart(r):
+			key = p.parseIdent()
+		default:
+			return nil, p.errorf("unexpected character %q, expected a key", r)
+		}
+		if _, exists := obj.Values[key]; exists {
+			return nil, &SyntaxError{Line: line, Column: column, Message: fmt.Sprintf("duplicate key %q", key)}
+		}
+		p.skipSpace(false)
+		if p.eof() || p.peek() != ':' {
+			return nil, p.errorf("expected : after key %q", key)
+		}
+		p.next()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		obj.Keys = append(obj.Keys, key)
+		obj.Values[key] = value
+		if err = p.parseSeparator('}', ',', ';'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Consume the separator after an array or object entry. A newline counts as separator too
+// Doesn't consume the closing bracket
+func (p *literalParser) parseSeparator(closing rune, separators ...rune) error {
+	if p.skipSpace(false) || p.eof() {
+		return nil
+	}
+	r := p.peek()
+	if r == '\n' || r == closing {
+		return nil
+	}
+	for _, sep := range separators {
+		if r == sep {
+			p.next()
+			return nil
+		}
+	}
+	return p.errorf("unexpected character %q, expected %q or a new line", r, separators[0])
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
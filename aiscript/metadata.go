@@ -0,0 +1,114 @@
+// Package aiscript extracts information from AiScript code uploaded as plugin or widget
+package aiscript
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A syntax problem in AiScript code, with the position it was found at
+type SyntaxError struct {
+	Line    int    // Line of the problem, starting at 1
+	Column  int    // Column of the problem in characters, starting at 1
+	Message string // What the problem is
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// Returned if the metadata header has a field of the wrong type
+var ErrBadMetadataField = errors.New("bad metadata field")
+
+// Metadata declared by AiScript code
+// Everything is empty if not declared
+type Metadata struct {
+	AiScriptVersion string        // The AiScript version from the "/// @ <version>" pragma
+	Name            string        // Name from the "### { ... }" header
+	Version         string        // Version from the header
+	Author          string        // Author from the header
+	Description     string        // Description from the header
+	Permissions     []string      // Permissions requested in the header
+	Config          *Object       // The config schema declared in the header
+	ConfigFields    []ConfigField // The settings declared in the config schema, in declaration order
+	HasHeader       bool          // Whether the code has a "### { ... }" header at all
+}
+
+var versionPragmaRegex = regexp.MustCompile(`(?m)^[ \t]*///[ \t]*@[ \t]*(\S+)[ \t]*\r?$`)
+var headerRegex = regexp.MustCompile(`(?m)^[ \t]*###`)
+
+// Extract the metadata from AiScript code
+// Code without pragma or header is fine, only malformed headers result in an error
+// Errors are either a *SyntaxError or wrap ErrBadMetadataField
+func ParseMetadata(code string) (*Metadata, error) {
+	meta := Metadata{}
+	if match := versionPragmaRegex.FindStringSubmatch(code); match != nil {
+		meta.AiScriptVersion = match[1]
+	}
+	loc := headerRegex.FindStringIndex(code)
+	if loc == nil {
+		return &meta, nil
+	}
+	meta.HasHeader = true
+
+	parser := newLiteralParser(code)
+	parser.seek(loc[1])
+	parser.skipSpace(true)
+	if parser.eof() || parser.peek() != '{' {
+		return nil, parser.errorf("expected { after ###")
+	}
+	header, err := parser.parseObject()
+	if err != nil {
+		return nil, err
+	}
+
+	stringFields := map[string]*string{
+		"name":        &meta.Name,
+		"version":     &meta.Version,
+		"author":      &meta.Author,
+		"description": &meta.Description,
+	}
+	for _, key := range []string{"name", "version", "author", "description"} {
+		target := stringFields[key]
+		value, ok := header.Get(key)
+		if !ok || value == nil {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			*target = strings.TrimSpace(v)
+		case float64:
+			*target = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return nil, fmt.Errorf("%w: %s must be a string", ErrBadMetadataField, key)
+		}
+	}
+	if value, ok := header.Get("permissions"); ok && value != nil {
+		list, isList := value.([]any)
+		if !isList {
+			return nil, fmt.Errorf("%w: permissions must be an array of strings", ErrBadMetadataField)
+		}
+		meta.Permissions = make([]string, 0, len(list))
+		for _, entry := range list {
+			permission, isString := entry.(string)
+			if !isString {
+				return nil, fmt.Errorf("%w: permissions must be an array of strings", ErrBadMetadataField)
+			}
+			meta.Permissions = append(meta.Permissions, strings.TrimSpace(permission))
+		}
+	}
+	if value, ok := header.Get("config"); ok && value != nil {
+		config, isObject := value.(*Object)
+		if !isObject {
+			return nil, fmt.Errorf("%w: config must be an object", ErrBadMetadataField)
+		}
+		meta.Config = config
+		if meta.ConfigFields, err = ParseConfigFields(config); err != nil {
+			return nil, err
+		}
+	}
+	return &meta, nil
+}
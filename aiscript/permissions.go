@@ -0,0 +1,86 @@
+package aiscript
+
+import (
+	"slices"
+	"strings"
+)
+
+// How much damage code could do with the Misskey permissions it requests
+type RiskLevel string
+
+const (
+	RISK_NONE           RiskLevel = "none"           // No permissions requested
+	RISK_READ_ONLY      RiskLevel = "read-only"      // Can only read data
+	RISK_WRITES_CONTENT RiskLevel = "writes-content" // Can create or change content like notes, reactions or drive files
+	RISK_WRITES_ACCOUNT RiskLevel = "writes-account" // Can change the account itself or who it interacts with
+	RISK_ADMIN          RiskLevel = "admin"          // Can access admin or moderation data
+)
+
+// All risk levels, from least to most risky
+var RiskLevels = []RiskLevel{
+	RISK_NONE,
+	RISK_READ_ONLY,
+	RISK_WRITES_CONTENT,
+	RISK_WRITES_ACCOUNT,
+	RISK_ADMIN,
+}
+
+// Write permissions affecting the account rather than content
+var accountPermissions = []string{
+	"write:account",
+	"write:following",
+	"write:blocks",
+	"write:mutes",
+}
+
+// Whether the string is a known risk level
+func IsRiskLevel(level string) bool {
+	return slices.Contains(RiskLevels, RiskLevel(level))
+}
+
+// Whether this level is at most as risky as the other one
+func (level RiskLevel) AtMost(other RiskLevel) bool {
+	return slices.Index(RiskLevels, level) <= slices.Index(RiskLevels, other)
+}
+
+// Get the risk level of the given set of permissions. The riskiest permission decides
+func ClassifyPermissions(permissions []string) RiskLevel {
+	level := RISK_NONE
+	for _, permission := range permissions {
+		var current RiskLevel
+		switch {
+		case strings.Contains(permission, "admin"):
+			current = RISK_ADMIN
+		case slices.Contains(accountPermissions, permission):
+			current = RISK_WRITES_ACCOUNT
+		case strings.HasPrefix(permission, "write:"):
+			current = RISK_WRITES_CONTENT
+		default:
+			current = RISK_READ_ONLY
+		}
+		if !current.AtMost(level) {
+			level = current
+		}
+	}
+	return level
+}
+
+// Compare the permissions of two consecutive versions
+// Returns the permissions only the next version requests and those only the previous one did, both sorted
+func DiffPermissions(previous, next []string) (added, removed []string) {
+	added = []string{}
+	removed = []string{}
+	for _, permission := range next {
+		if !slices.Contains(previous, permission) && !slices.Contains(added, permission) {
+			added = append(added, permission)
+		}
+	}
+	for _, permission := range previous {
+		if !slices.Contains(next, permission) && !slices.Contains(removed, permission) {
+			removed = append(removed, permission)
+		}
+	}
+	slices.Sort(added)
+	slices.Sort(removed)
+	return added, removed
+}
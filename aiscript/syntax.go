@@ -0,0 +1,655 @@
+package aiscript
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// AiScript versions before this one used a syntax with sigils like "#x = 1", which isn't checked
+const MODERN_SYNTAX_SINCE = "0.12.0"
+
+// How deeply blocks and expressions may be nested before the code is rejected
+const MAX_NESTING = 200
+
+// Words that start statements or are part of them and can't be used as expressions
+var statementKeywords = []string{"let", "var", "return", "each", "for", "loop", "break", "continue", "elif", "else"}
+
+// Operators combining two expressions
+var binaryOperators = []string{"+", "-", "*", "/", "%", "^", "==", "!=", "<", "<=", ">", ">=", "&&", "||"}
+
+// Check AiScript code for syntax errors
+// Code for AiScript versions before MODERN_SYNTAX_SINCE or versions that aren't known is only checked for
+// unterminated strings and unbalanced brackets, since its syntax differs. Code without version is checked
+// with the current syntax
+// Returns a *SyntaxError for the first problem found
+func CheckSyntax(code, aiscriptVersion string) error {
+	tokens, err := Tokenize(code)
+	if err != nil {
+		return err
+	}
+	checker := syntaxChecker{tokens: tokens, endLine: strings.Count(code, "\n") + 1}
+	checker.endColumn = utf8.RuneCountInString(code[strings.LastIndexByte(code, '\n')+1:]) + 1
+	if hasModernSyntax(aiscriptVersion) {
+		return checker.statements("")
+	}
+	return checker.brackets()
+}
+
+func hasModernSyntax(aiscriptVersion string) bool {
+	if aiscriptVersion == "" {
+		return true
+	}
+	return Classify(aiscriptVersion) != COMPAT_UNKNOWN && compareVersions(aiscriptVersion, MODERN_SYNTAX_SINCE) >= 0
+}
+
+// Recursive descent recogniser for AiScript. It only checks the syntax and doesn't build a tree
+type syntaxChecker struct {
+	tokens    []Token
+	pos       int
+	depth     int // Current nesting of blocks and expressions
+	endLine   int // Where the code ends, for errors about missing tokens
+	endColumn int
+}
+
+func (c *syntaxChecker) eof() bool {
+	return c.pos >= len(c.tokens)
+}
+
+// The current token. Nil at the end of the code
+func (c *syntaxChecker) peek() *Token {
+	if c.eof() {
+		return nil
+	}
+	return &c.tokens[c.pos]
+}
+
+// Whether the current token is the given operator, bracket or word
+func (c *syntaxChecker) is(text string) bool {
+	token := c.peek()
+	return token != nil && (token.Kind == TOKEN_PUNCT || token.Kind == TOKEN_IDENT) && token.Text == text
+}
+
+// Consume the current token if it is the given operator, bracket or word
+func (c *syntaxChecker) accept(text string) bool {
+	if c.is(text) {
+		c.pos++
+		return true
+	}
+	return false
+}
+
+func (c *syntaxChecker) expect(text string) error {
+	if !c.accept(text) {
+		return c.unexpected(fmt.Sprintf("%q", text))
+	}
+	return nil
+}
+
+func (c *syntaxChecker) expectIdent() error {
+	if token := c.peek(); token == nil || token.Kind != TOKEN_IDENT {
+		return c.unexpected("a name")
+	}
+	c.pos++
+	return nil
+}
+
+// Whether the current statement ends before the current token
+func (c *syntaxChecker) atStatementEnd() bool {
+	token := c.peek()
+	return token == nil || token.NewlineBefore || c.is(";") || c.is("}")
+}
+
+// An error about the current token, naming what was expected instead
+func (c *syntaxChecker) unexpected(expected string) *SyntaxError {
+	token := c.peek()
+	if token == nil {
+		return &SyntaxError{
+			Line:    c.endLine,
+			Column:  c.endColumn,
+			Message: "unexpected end of code, expected " + expected,
+		}
+	}
+	var found string
+	switch token.Kind {
+	case TOKEN_STRING:
+		found = "string"
+	case TOKEN_TEMPLATE:
+		found = "template string"
+	case TOKEN_NUMBER:
+		found = "number " + token.Text
+	default:
+		found = strconv.Quote(token.Text)
+	}
+	return &SyntaxError{
+		Line:    token.Line,
+		Column:  token.Column,
+		Message: fmt.Sprintf("unexpected %s, expected %s", found, expected),
+	}
+}
+
+func (c *syntaxChecker) enter() error {
+	c.depth++
+	if c.depth > MAX_NESTING {
+		token := c.peek()
+		if token == nil {
+			return &SyntaxError{Line: c.endLine, Column: c.endColumn, Message: "code is nested too deeply"}
+		}
+		return &SyntaxError{Line: token.Line, Column: token.Column, Message: "code is nested too deeply"}
+	}
+	return nil
+}
+
+func (c *syntaxChecker) leave() {
+	c.depth--
+}
+
+// Check statements up to the closing bracket, which isn't consumed. An empty closing means the end of the code
+// Statements are separated by new lines or ";"
+func (c *syntaxChecker) statements(closing string) error {
+	for {
+		for c.accept(";") {
+		}
+		if c.eof() {
+			if closing != "" {
+				return c.unexpected(fmt.Sprintf("%q", closing))
+			}
+			return nil
+		}
+		if closing != "" && c.is(closing) {
+			return nil
+		}
+		if err := c.statement(); err != nil {
+			return err
+		}
+		if !c.eof() && !c.is(";") && !(closing != "" && c.is(closing)) && !c.peek().NewlineBefore {
+			return c.unexpected("a new line or \";\" after the statement")
+		}
+	}
+}
+
+func (c *syntaxChecker) statement() error {
+	if err := c.enter(); err != nil {
+		return err
+	}
+	defer c.leave()
+	switch {
+	case c.accept("###"):
+		// The metadata header
+		return c.object()
+	case c.is("#") && c.pos+1 < len(c.tokens) && c.tokens[c.pos+1].Text == "[":
+		// An attribute for the next definition, like "#[name value]". The definition may follow on the same line
+		c.pos += 2
+		if err := c.expectIdent(); err != nil {
+			return err
+		}
+		if !c.is("]") {
+			if err := c.expression(); err != nil {
+				return err
+			}
+		}
+		if err := c.expect("]"); err != nil {
+			return err
+		}
+		if c.atStatementEnd() {
+			return nil
+		}
+		return c.statement()
+	case c.accept("::"):
+		// A namespace
+		if err := c.expectIdent(); err != nil {
+			return err
+		}
+		return c.block()
+	case c.is("@") && c.pos+1 < len(c.tokens) && c.tokens[c.pos+1].Kind == TOKEN_IDENT:
+		// A function definition
+		c.pos += 2
+		return c.function()
+	case c.accept("let"), c.accept("var"):
+		if err := c.pattern(); err != nil {
+			return err
+		}
+		if c.accept(":") {
+			if err := c.typeName(); err != nil {
+				return err
+			}
+		}
+		if err := c.expect("="); err != nil {
+			return err
+		}
+		return c.expression()
+	case c.accept("return"):
+		if c.atStatementEnd() {
+			return nil
+		}
+		return c.expression()
+	case c.accept("break"), c.accept("continue"):
+		return nil
+	case c.accept("each"):
+		return c.loopHead(true)
+	case c.accept("for"):
+		return c.loopHead(false)
+	case c.accept("loop"):
+		return c.block()
+	case c.accept("<:"):
+		return c.expression()
+	}
+	if err := c.expression(); err != nil {
+		return err
+	}
+	if c.accept("=") || c.accept("+=") || c.accept("-=") {
+		return c.expression()
+	}
+	return nil
+}
+
+// The head and body of "each let x, items { ... }" or "for let i = 0, 10 { ... }", optionally in brackets
+func (c *syntaxChecker) loopHead(isEach bool) error {
+	bracketed := c.accept("(")
+	if c.accept("let") || c.accept("var") {
+		if err := c.pattern(); err != nil {
+			return err
+		}
+		if !isEach && c.accept("=") {
+			if err := c.expression(); err != nil {
+				return err
+			}
+		}
+		if err := c.expect(","); err != nil {
+			return err
+		}
+	} else if isEach {
+		return c.unexpected(`"let"`)
+	}
+	if err := c.expression(); err != nil {
+		return err
+	}
+	if bracketed {
+		if err := c.expect(")"); err != nil {
+			return err
+		}
+	}
+	return c.body()
+}
+
+// A name to define, or a list or object of names to destructure
+func (c *syntaxChecker) pattern() error {
+	switch {
+	case c.accept("["):
+		return c.list("]", c.pattern)
+	case c.accept("{"):
+		return c.list("}", func() error {
+			if err := c.expectIdent(); err != nil {
+				return err
+			}
+			if c.accept(":") {
+				return c.pattern()
+			}
+			return nil
+		})
+	default:
+		return c.expectIdent()
+	}
+}
+
+// Entries separated by "," or new lines up to the closing bracket, which is consumed
+func (c *syntaxChecker) list(closing string, entry func() error) error {
+	for {
+		if c.accept(closing) {
+			return nil
+		}
+		if err := entry(); err != nil {
+			return err
+		}
+		if !c.accept(",") && !c.is(closing) && (c.eof() || !c.peek().NewlineBefore) {
+			return c.unexpected(fmt.Sprintf(`"," or %q`, closing))
+		}
+	}
+}
+
+// The parameters, optional return type and body of a function after the "@" and its name
+func (c *syntaxChecker) function() error {
+	if err := c.expect("("); err != nil {
+		return err
+	}
+	err := c.list(")", func() error {
+		if err := c.expectIdent(); err != nil {
+			return err
+		}
+		c.accept("?")
+		if c.accept(":") {
+			if err := c.typeName(); err != nil {
+				return err
+			}
+		}
+		if c.accept("=") {
+			return c.expression()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if c.accept(":") {
+		if err = c.typeName(); err != nil {
+			return err
+		}
+	}
+	return c.block()
+}
+
+// A type, like "num", "arr<str>" or "@(num) => str"
+func (c *syntaxChecker) typeName() error {
+	if c.accept("@") {
+		if err := c.expect("("); err != nil {
+			return err
+		}
+		if err := c.list(")", c.typeName); err != nil {
+			return err
+		}
+		if err := c.expect("=>"); err != nil {
+			return err
+		}
+		return c.typeName()
+	}
+	if err := c.expectIdent(); err != nil {
+		return err
+	}
+	if c.accept("<") {
+		if err := c.typeName(); err != nil {
+			return err
+		}
+		for c.accept(",") {
+			if err := c.typeName(); err != nil {
+				return err
+			}
+		}
+		return c.expect(">")
+	}
+	return nil
+}
+
+// A block in braces, or a single statement
+func (c *syntaxChecker) body() error {
+	if c.is("{") {
+		return c.block()
+	}
+	return c.statement()
+}
+
+func (c *syntaxChecker) block() error {
+	if err := c.expect("{"); err != nil {
+		return err
+	}
+	if err := c.statements("}"); err != nil {
+		return err
+	}
+	return c.expect("}")
+}
+
+func (c *syntaxChecker) expression() error {
+	if err := c.enter(); err != nil {
+		return err
+	}
+	defer c.leave()
+	if err := c.unary(); err != nil {
+		return err
+	}
+	for {
+		token := c.peek()
+		if token == nil || token.Kind != TOKEN_PUNCT || !slices.Contains(binaryOperators, token.Text) {
+			return nil
+		}
+		// A sign at the start of a line starts the next statement, a "*" the default arm of a match
+		if token.NewlineBefore && (token.Text == "+" || token.Text == "-" || token.Text == "*") {
+			return nil
+		}
+		c.pos++
+		if err := c.unary(); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *syntaxChecker) unary() error {
+	for c.accept("!") || c.accept("-") || c.accept("+") {
+	}
+	if err := c.primary(); err != nil {
+		return err
+	}
+	// Calls, indexes and properties. Brackets on a new line start the next statement
+	for {
+		token := c.peek()
+		switch {
+		case token == nil:
+			return nil
+		case c.is("(") && !token.NewlineBefore:
+			c.pos++
+			if err := c.list(")", c.expression); err != nil {
+				return err
+			}
+		case c.is("[") && !token.NewlineBefore:
+			c.pos++
+			if err := c.expression(); err != nil {
+				return err
+			}
+			if err := c.expect("]"); err != nil {
+				return err
+			}
+		case c.accept("."):
+			if err := c.expectIdent(); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *syntaxChecker) primary() error {
+	token := c.peek()
+	if token == nil {
+		return c.unexpected("an expression")
+	}
+	switch token.Kind {
+	case TOKEN_NUMBER:
+		if _, err := strconv.ParseFloat(token.Text, 64); err != nil {
+			return &SyntaxError{Line: token.Line, Column: token.Column, Message: fmt.Sprintf("invalid number %q", token.Text)}
+		}
+		c.pos++
+		return nil
+	case TOKEN_STRING:
+		c.pos++
+		return nil
+	case TOKEN_IDENT:
+		return c.keywordOrName()
+	}
+	switch {
+	case c.accept("`"):
+		return c.template()
+	case c.accept("("):
+		if err := c.expression(); err != nil {
+			return err
+		}
+		return c.expect(")")
+	case c.accept("["):
+		return c.list("]", c.expression)
+	case c.is("{"):
+		return c.object()
+	case c.accept("@"):
+		return c.function()
+	}
+	return c.unexpected("an expression")
+}
+
+func (c *syntaxChecker) keywordOrName() error {
+	token := c.peek()
+	c.pos++
+	switch token.Text {
+	case "if":
+		if err := c.expression(); err != nil {
+			return err
+		}
+		if err := c.body(); err != nil {
+			return err
+		}
+		for c.accept("elif") {
+			if err := c.expression(); err != nil {
+				return err
+			}
+			if err := c.body(); err != nil {
+				return err
+			}
+		}
+		if c.accept("else") {
+			return c.body()
+		}
+		return nil
+	case "match":
+		return c.match()
+	case "eval":
+		return c.block()
+	case "exists":
+		return c.expectIdent()
+	}
+	if slices.Contains(statementKeywords, token.Text) {
+		c.pos--
+		return c.unexpected("an expression")
+	}
+	return nil
+}
+
+// The subject and arms of a match expression after "match"
+// Arms are either "value => result" with "*" as default, or "case value => result" and "default => result"
+func (c *syntaxChecker) match() error {
+	if err := c.expression(); err != nil {
+		return err
+	}
+	if err := c.expect("{"); err != nil {
+		return err
+	}
+	return c.list("}", func() error {
+		switch {
+		case c.accept("default"), c.accept("*"):
+		default:
+			c.accept("case")
+			if err := c.expression(); err != nil {
+				return err
+			}
+		}
+		if err := c.expect("=>"); err != nil {
+			return err
+		}
+		if c.is("{") && !c.looksLikeObject() {
+			return c.block()
+		}
+		return c.expression()
+	})
+}
+
+// Whether the brace at the current token opens an object literal rather than a block
+func (c *syntaxChecker) looksLikeObject() bool {
+	if c.pos+1 >= len(c.tokens) {
+		return false
+	}
+	next := c.tokens[c.pos+1]
+	if next.Text == "}" && next.Kind == TOKEN_PUNCT {
+		return true
+	}
+	if next.Kind != TOKEN_IDENT && next.Kind != TOKEN_STRING {
+		return false
+	}
+	return strings.Contains(next.Text, ":") ||
+		(c.pos+2 < len(c.tokens) && c.tokens[c.pos+2].Kind == TOKEN_PUNCT && c.tokens[c.pos+2].Text == ":")
+}
+
+// An object literal, like "{ name: value }". Entries are separated by ",", ";" or new lines
+func (c *syntaxChecker) object() error {
+	if err := c.expect("{"); err != nil {
+		return err
+	}
+	for {
+		for c.accept(",") || c.accept(";") {
+		}
+		if c.accept("}") {
+			return nil
+		}
+		token := c.peek()
+		if token == nil || (token.Kind != TOKEN_IDENT && token.Kind != TOKEN_STRING) {
+			return c.unexpected("a key or \"}\"")
+		}
+		c.pos++
+		// Without space the tokenizer takes "Key:value" for a name in a namespace
+		if token.Kind == TOKEN_IDENT && strings.Contains(token.Text, ":") {
+			c.pos--
+			if err := c.expression(); err != nil {
+				return err
+			}
+		} else {
+			if err := c.expect(":"); err != nil {
+				return err
+			}
+			if err := c.expression(); err != nil {
+				return err
+			}
+		}
+		if !c.is(",") && !c.is(";") && !c.is("}") && (c.eof() || !c.peek().NewlineBefore) {
+			return c.unexpected(`",", ";" or "}"`)
+		}
+	}
+}
+
+// The rest of a template string after the opening "`"
+func (c *syntaxChecker) template() error {
+	for {
+		switch {
+		case c.accept("`"):
+			return nil
+		case c.accept("{"):
+			if err := c.expression(); err != nil {
+				return err
+			}
+			if err := c.expect("}"); err != nil {
+				return err
+			}
+		case !c.eof() && c.peek().Kind == TOKEN_TEMPLATE:
+			c.pos++
+		default:
+			return c.unexpected("\"`\"")
+		}
+	}
+}
+
+// Check only that brackets are balanced, for code whose syntax isn't known
+func (c *syntaxChecker) brackets() error {
+	pairs := map[string]string{"(": ")", "[": "]", "{": "}"}
+	open := []*Token{}
+	for i := range c.tokens {
+		token := &c.tokens[i]
+		if token.Kind != TOKEN_PUNCT {
+			continue
+		}
+		if _, opens := pairs[token.Text]; opens {
+			open = append(open, token)
+			continue
+		}
+		if !slices.Contains([]string{")", "]", "}"}, token.Text) {
+			continue
+		}
+		if len(open) == 0 || pairs[open[len(open)-1].Text] != token.Text {
+			return &SyntaxError{Line: token.Line, Column: token.Column, Message: fmt.Sprintf("unexpected %q", token.Text)}
+		}
+		open = open[:len(open)-1]
+	}
+	if len(open) > 0 {
+		last := open[len(open)-1]
+		return &SyntaxError{
+			Line:    c.endLine,
+			Column:  c.endColumn,
+			Message: fmt.Sprintf("unexpected end of code, %q opened at line %d is never closed", last.Text, last.Line),
+		}
+	}
+	return nil
+}
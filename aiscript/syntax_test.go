@@ -0,0 +1,167 @@
+package aiscript
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckSyntaxAcceptsValidCode(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+	}{
+		{"empty", ""},
+		{"header", `/// @ 0.19.0
+### {
+	name: "Hello"
+	version: "1.0.0"
+	author: "someone"
+	permissions: ["write:notes"]
+	config: {
+		greeting: { type: "string", label: "Greeting", default: "hi" }
+	}
+}
+Mk:dialog("Hello", Plugin:config.greeting)`},
+		{"variables and assignments", `let a = 1
+var b = "x"; b = 'y'
+b += "z"
+let c: num = -a * (2 + 3) / 4 % 5 ^ 6`},
+		{"functions", `@add(a: num, b?: num = 1): num {
+	return a + b
+}
+let f = @(x) { x * 2 }
+<: add(1, f(2))`},
+		{"if and match", `let x = 3
+let size = if x > 2 { "big" } elif x > 1 { "medium" } else { "small" }
+let name = match x {
+	1 => "one"
+	2 => { "two" }
+	* => "many"
+}
+let other = match x {
+	case 1 => "one"
+	default => "other"
+}`},
+		{"loops", `each let item, [1, 2, 3] {
+	<: item
+}
+each (let item, [1]) <: item
+for let i = 0, 10 {
+	if i == 5 continue
+	if i == 8 break
+}
+for (3) { <: "again" }
+loop { break }`},
+		{"templates", "let who = \"you\"\n" +
+			"<: `hello {who}, {`nested {1 + 1}`} and {{ a: 1 }.a}`\n" +
+			"<: ``"},
+		{"objects and lists", `let o = { a: 1, "b": [1, 2,], c: { d: true }; e: null }
+let {a, b: renamed} = o
+let [first, second] = [1, 2]
+<: o.c.d
+<: o["a"]
+let p = {a:1}`},
+		{"namespaces", `:: util {
+	let x = 1
+	@double(v) { v * 2 }
+}
+let y = util:x
+<: util:double(y)
+<: Ui:C:text({ text: "x" })`},
+		{"attributes", `#[ui true]
+@onClick() { Mk:api("i", {}) }
+#[version "1.0"] let v = 1`},
+		{"comments", `// a comment
+let a = 1 /* inline */ + 2
+/*
+ multi line
+*/`},
+		{"statement starting with a sign", "let a = 1\n-a\n+a"},
+		{"eval and exists", "let a = eval { 1 }\n<: exists a"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := CheckSyntax(test.code, ""); err != nil {
+				t.Errorf("CheckSyntax() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestCheckSyntaxRejectsInvalidCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		line    int
+		column  int
+		message string
+	}{
+		{"unterminated string", "let a = 1\nlet b = \"x", 2, 9, "unterminated string"},
+		{"unterminated template", "<: `a {1}", 1, 10, "unterminated template string"},
+		{"missing closing brace", "@f() {\n\tlet a = 1\n", 3, 1, "unexpected end of code"},
+		{"extra closing brace", "let a = 1\n}", 2, 1, `unexpected "}"`},
+		{"two statements on a line", "let a = 1 let b = 2", 1, 11, "after the statement"},
+		{"missing value", "let a =", 1, 8, "expected an expression"},
+		{"keyword as expression", "let a = return", 1, 9, `unexpected "return"`},
+		{"missing name", "let = 1", 1, 5, "expected a name"},
+		{"each without let", "each [1] { }", 1, 6, `expected "let"`},
+		{"missing arrow in match", "match 1 {\n\t1 \"one\"\n}", 2, 4, `expected "=>"`},
+		{"unclosed call", "<: f(1, 2", 1, 10, "unexpected end of code"},
+		{"missing comma in list", "let l = [1 2]", 1, 12, `expected "," or "]"`},
+		{"missing colon in object", "let o = { a 1 }", 1, 13, `expected ":"`},
+		{"invalid number", "let n = 1.2.3", 1, 9, "invalid number"},
+		{"column counts characters", "let ü = \"ä\" }", 1, 13, `unexpected "}"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckSyntax(test.code, "")
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("CheckSyntax() = %v, want a *SyntaxError", err)
+			}
+			if syntaxErr.Line != test.line || syntaxErr.Column != test.column {
+				t.Errorf("position = %d:%d, want %d:%d (%s)",
+					syntaxErr.Line, syntaxErr.Column, test.line, test.column, syntaxErr.Message)
+			}
+			if !strings.Contains(syntaxErr.Message, test.message) {
+				t.Errorf("message = %q, want it to contain %q", syntaxErr.Message, test.message)
+			}
+		})
+	}
+}
+
+func TestCheckSyntaxVersions(t *testing.T) {
+	// "#x = 1" is how variables were defined before 0.12.0
+	legacy := "#x = 1\n<: x"
+	tests := []struct {
+		name    string
+		code    string
+		version string
+		wantErr bool
+	}{
+		{"legacy syntax for an old version", legacy, "0.11.1", false},
+		{"legacy syntax for an unknown version", legacy, "9.0.0", false},
+		{"legacy syntax for a modern version", legacy, "0.19.0", true},
+		{"legacy syntax without version", legacy, "", true},
+		{"unbalanced brackets for an old version", "#x = (1", "0.11.1", true},
+		{"crossed brackets for an old version", "#x = (1]", "0.11.1", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckSyntax(test.code, test.version)
+			if (err != nil) != test.wantErr {
+				t.Errorf("CheckSyntax() = %v, want error: %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckSyntaxNesting(t *testing.T) {
+	code := strings.Repeat("(", MAX_NESTING+1) + "1" + strings.Repeat(")", MAX_NESTING+1)
+	err := CheckSyntax(code, "")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) || !strings.Contains(syntaxErr.Message, "nested too deeply") {
+		t.Errorf("CheckSyntax() = %v, want an error about nesting", err)
+	}
+}
@@ -0,0 +1,161 @@
+package aiscript
+
+import (
+	"strings"
+	"unicode"
+)
+
+// What kind of source text a token is
+type TokenKind int
+
+const (
+	TOKEN_IDENT    TokenKind = iota // Names and keywords, like "let" or "Mk:api"
+	TOKEN_NUMBER                    // Number literals, like "12" or "0.5"
+	TOKEN_STRING                    // Contents of a "..." or '...' string, with escapes resolved
+	TOKEN_TEMPLATE                  // A literal piece of a `...` template string, between its embedded expressions
+	TOKEN_PUNCT                     // Operators and brackets. Template strings start and end with a "`" token
+)
+
+// A token of AiScript code
+type Token struct {
+	Kind          TokenKind
+	Text          string // The source text, or the contents for strings and template pieces
+	Line          int    // Line the token starts at, starting at 1
+	Column        int    // Column the token starts at in characters, starting at 1
+	NewlineBefore bool   // Whether there is a line break between this token and the previous one
+}
+
+// Operators made of more than one character, longest first
+var multiCharPuncts = []string{"###", "&&", "||", "==", "!=", "<=", ">=", "=>", "<:", "+=", "-=", "::"}
+
+// Split AiScript code into tokens. Comments and white space are dropped
+// Names in a namespace, like "Mk:api" or "util:x", are a single token if there is no space around the ":".
+// Keys of object literals written like that, as in "{key:value}", end up as single token as well
+// On a *SyntaxError the tokens before the problem are returned as well
+func Tokenize(code string) ([]Token, error) {
+	p := newLiteralParser(code)
+	tokens := []Token{}
+	// Brace depth inside each template expression that is currently open, innermost last
+	templateDepths := []int{}
+	newline := false
+	for {
+		if p.skipSpace(true) {
+			newline = true
+		}
+		if p.eof() {
+			if len(templateDepths) > 0 {
+				return tokens, p.errorf("unterminated template string")
+			}
+			return tokens, nil
+		}
+		token := Token{Line: p.line, Column: p.column, NewlineBefore: newline}
+		newline = false
+		switch r := p.peek(); {
+		case r == '"' || r == '\'':
+			text, err := p.parseString()
+			if err != nil {
+				// Point at where the string starts rather than at the end of the code
+				return tokens, &SyntaxError{Line: token.Line, Column: token.Column, Message: "unterminated string"}
+			}
+			token.Kind, token.Text = TOKEN_STRING, text
+		case r == '`':
+			p.next()
+			token.Kind, token.Text = TOKEN_PUNCT, "`"
+			tokens = append(tokens, token)
+			var inExpression bool
+			var err error
+			if tokens, inExpression, err = tokenizeTemplate(p, tokens); err != nil {
+				return tokens, err
+			}
+			if inExpression {
+				templateDepths = append(templateDepths, 0)
+			}
+			continue
+		case unicode.IsDigit(r):
+			start := p.pos
+			for !p.eof() && (unicode.IsDigit(p.peek()) || p.peek() == '.') {
+				p.next()
+			}
+			token.Kind, token.Text = TOKEN_NUMBER, string(p.src[start:p.pos])
+		case isIdentStart(r):
+			token.Kind, token.Text = TOKEN_IDENT, p.parseIdent()
+			for p.peek() == ':' && p.pos+1 < len(p.src) && isIdentStart(p.src[p.pos+1]) {
+				p.next()
+				token.Text += ":" + p.parseIdent()
+			}
+		case r == '{' && len(templateDepths) > 0:
+			p.next()
+			templateDepths[len(templateDepths)-1]++
+			token.Kind, token.Text = TOKEN_PUNCT, "{"
+		case r == '}' && len(templateDepths) > 0:
+			p.next()
+			token.Kind, token.Text = TOKEN_PUNCT, "}"
+			depth := &templateDepths[len(templateDepths)-1]
+			*depth--
+			if *depth > 0 {
+				break
+			}
+			// The expression embedded into a template string ended, so the template continues
+			templateDepths = templateDepths[:len(templateDepths)-1]
+			tokens = append(tokens, token)
+			var inExpression bool
+			var err error
+			if tokens, inExpression, err = tokenizeTemplate(p, tokens); err != nil {
+				return tokens, err
+			}
+			if inExpression {
+				templateDepths = append(templateDepths, 0)
+			}
+			continue
+		default:
+			token.Kind, token.Text = TOKEN_PUNCT, string(r)
+			rest := string(p.src[p.pos:min(p.pos+3, len(p.src))])
+			for _, punct := range multiCharPuncts {
+				if strings.HasPrefix(rest, punct) {
+					token.Text = punct
+					break
+				}
+			}
+			for range []rune(token.Text) {
+				p.next()
+			}
+		}
+		tokens = append(tokens, token)
+	}
+}
+
+// Read the literal part of a template string up to the next embedded expression or the closing "`"
+// Stops in front of the "{" of an expression and returns inExpression=true.
+// The closing "`" is consumed and added as token
+func tokenizeTemplate(p *literalParser, tokens []Token) (_ []Token, inExpression bool, err error) {
+	piece := Token{Kind: TOKEN_TEMPLATE, Line: p.line, Column: p.column}
+	builder := strings.Builder{}
+	for {
+		if p.eof() {
+			return tokens, false, p.errorf("unterminated template string")
+		}
+		switch p.peek() {
+		case '\\':
+			p.next()
+			if p.eof() {
+				return tokens, false, p.errorf("unterminated template string")
+			}
+			builder.WriteRune(p.next())
+			continue
+		case '{', '`':
+		default:
+			builder.WriteRune(p.next())
+			continue
+		}
+		if builder.Len() > 0 {
+			piece.Text = builder.String()
+			tokens = append(tokens, piece)
+		}
+		if p.peek() == '{' {
+			return tokens, true, nil
+		}
+		tokens = append(tokens, Token{Kind: TOKEN_PUNCT, Text: "`", Line: p.line, Column: p.column})
+		p.next()
+		return tokens, false, nil
+	}
+}
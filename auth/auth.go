@@ -1,21 +1,72 @@
 package auth
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/alexedwards/argon2id"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
 
 	"github.com/mstarongithub/mk-plugin-repo/storage"
+	"github.com/mstarongithub/mk-plugin-repo/util"
 )
 
+const MIN_PASSWORD_LENGTH = 8
+
 type AuthManager struct {
 	storage     *storage.Storage
 	validTokens [][]byte
+	tokenLock   sync.RWMutex
 }
 
-func NewAuthManager(store *storage.Storage) (*AuthManager, error) {}
+var ErrNoStorage = errors.New("no storage provided")
+var ErrInvalidToken = errors.New("invalid or revoked token")
+var ErrMissingUsername = errors.New("username must not be empty")
+var ErrPasswordTooShort = fmt.Errorf(
+	"password must be at least %d characters long",
+	MIN_PASSWORD_LENGTH,
+)
+
+func NewAuthManager(store *storage.Storage) (*AuthManager, error) {
+	if store == nil {
+		return nil, ErrNoStorage
+	}
+	return &AuthManager{
+		storage:     store,
+		validTokens: [][]byte{},
+	}, nil
+}
 
+// Register a new account. The password is stored as argon2id hash
+// New accounts are not approved and can't publish anything until they are
+func (am *AuthManager) Register(username, mail, password string) (*storage.Account, error) {
+	if username == "" {
+		return nil, ErrMissingUsername
+	}
+	if len(password) < MIN_PASSWORD_LENGTH {
+		return nil, ErrPasswordTooShort
+	}
+	hash, err := argon2id.CreateHash(password, argon2id.DefaultParams)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	acc, err := am.storage.NewAccount(username, mail, hash)
+	if err != nil {
+		return nil, err
+	}
+	logrus.WithFields(logrus.Fields{
+		"account-id": acc.ID,
+		"username":   username,
+	}).Infoln("Registered new account")
+	return acc, nil
+}
+
+// Try to log in with the given credentials
+// Returns whether the credentials matched and, if they did, a new session token
 func (am *AuthManager) Login(username, password string) (bool, string, error) {
 	acc, err := am.storage.FindAccountByName(username)
 	if err != nil {
@@ -25,9 +76,64 @@ func (am *AuthManager) Login(username, password string) (bool, string, error) {
 			return false, "", err
 		}
 	}
-	match, _ := argon2id.ComparePasswordAndHash(password, string(acc.PasswordHash))
-	if match {
+	match, _ := argon2id.ComparePasswordAndHash(password, acc.Password)
+	if !match {
+		logrus.WithField("username", username).Debugln("Login attempt with wrong password")
+		return false, "", nil
+	}
+	token, err := util.CreateToken(acc.Name)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to create session token: %w", err)
+	}
+
+	am.tokenLock.Lock()
+	defer am.tokenLock.Unlock()
+	am.pruneExpiredTokens()
+	am.validTokens = append(am.validTokens, []byte(token))
+	logrus.WithField("username", username).Debugln("Login successful")
+	return true, token, nil
+}
 
+// Revoke a session token. Revoking an unknown token is not an error
+func (am *AuthManager) Logout(token string) {
+	am.tokenLock.Lock()
+	defer am.tokenLock.Unlock()
+	am.validTokens = slices.DeleteFunc(am.validTokens, func(t []byte) bool {
+		return bytes.Equal(t, []byte(token))
+	})
+}
+
+// Get the account a session token belongs to
+// Returns ErrInvalidToken if the token is invalid, expired or has been revoked
+func (am *AuthManager) AccountFromToken(token string) (*storage.Account, error) {
+	am.tokenLock.RLock()
+	known := slices.ContainsFunc(am.validTokens, func(t []byte) bool {
+		return bytes.Equal(t, []byte(token))
+	})
+	am.tokenLock.RUnlock()
+	if !known {
+		return nil, ErrInvalidToken
+	}
+	username, err := util.GetTokenSubject(token)
+	if err != nil {
+		logrus.WithError(err).Debugln("Failed to verify session token")
+		return nil, ErrInvalidToken
 	}
-	return match, "", nil
+	acc, err := am.storage.FindAccountByName(username)
+	if err != nil {
+		if errors.Is(err, storage.ErrAccountNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	return acc, nil
+}
+
+// Remove all tokens that have expired. Expects the token lock to be held
+func (am *AuthManager) pruneExpiredTokens() {
+	now := time.Now()
+	am.validTokens = slices.DeleteFunc(am.validTokens, func(t []byte) bool {
+		exp, err := util.GetTokenExpiry(string(t))
+		return err != nil || exp.Before(now)
+	})
 }
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/mstarongithub/mk-plugin-repo/storage"
+)
+
+type AuthContextKey string
+
+const (
+	CONTEXT_KEY_ACCOUNT      = AuthContextKey("account")
+	CONTEXT_KEY_TOKEN        = AuthContextKey("token")
+	CONTEXT_KEY_ACCESS_TOKEN = AuthContextKey("access_token")
+)
+
+// Name of the cookie the session token is stored in for browser clients
+const SESSION_COOKIE_NAME = "mk_plugin_repo_session"
+
+// Middleware resolving the account of the current request
+// Looks for a token in the Authorization header (Bearer) first, then in the session cookie
+// The token may either be a session token or a personal access token
+// Requests without a valid token are passed through without an account in their context
+func (am *AuthManager) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := tokenFromHeaderOrCookie(r)
+		if token == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if strings.HasPrefix(token, storage.ACCESS_TOKEN_PREFIX) {
+			acc, accessToken, err := am.storage.AccountFromAccessToken(token)
+			if err != nil {
+				if !errors.Is(err, storage.ErrInvalidAccessToken) {
+					logrus.WithError(err).Errorln("Failed to resolve account for access token")
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+			ctx := context.WithValue(r.Context(), CONTEXT_KEY_ACCOUNT, acc)
+			ctx = context.WithValue(ctx, CONTEXT_KEY_ACCESS_TOKEN, accessToken)
+			h.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		acc, err := am.AccountFromToken(token)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidToken) {
+				logrus.WithError(err).Errorln("Failed to resolve account for session token")
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+		ctx := context.WithValue(r.Context(), CONTEXT_KEY_ACCOUNT, acc)
+		ctx = context.WithValue(ctx, CONTEXT_KEY_TOKEN, token)
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Get the account the request was authenticated as
+// Returns nil if the request isn't authenticated
+func AccountFromRequest(r *http.Request) *storage.Account {
+	acc, ok := r.Context().Value(CONTEXT_KEY_ACCOUNT).(*storage.Account)
+	if !ok {
+		acc = nil
+	}
+	return acc
+}
+
+// Get the personal access token the request was authenticated with
+// Returns nil if the request isn't authenticated or used a session token
+func AccessTokenFromRequest(r *http.Request) *storage.AccessToken {
+	token, ok := r.Context().Value(CONTEXT_KEY_ACCESS_TOKEN).(*storage.AccessToken)
+	if !ok {
+		token = nil
+	}
+	return token
+}
+
+// Whether the request is allowed to perform actions requiring the given scope
+// Session tokens are allowed everything, access tokens only what they have been granted
+func RequestHasScope(r *http.Request, scope string) bool {
+	if AccountFromRequest(r) == nil {
+		return false
+	}
+	if token := AccessTokenFromRequest(r); token != nil {
+		return token.HasScope(scope)
+	}
+	return true
+}
+
+// Get the session token the request was authenticated with
+// Returns an empty string if the request isn't authenticated or used an access token
+func TokenFromRequest(r *http.Request) string {
+	token, ok := r.Context().Value(CONTEXT_KEY_TOKEN).(string)
+	if !ok {
+		token = ""
+	}
+	return token
+}
+
+func tokenFromHeaderOrCookie(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	if cookie, err := r.Cookie(SESSION_COOKIE_NAME); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
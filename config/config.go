@@ -15,6 +15,7 @@ var GlobalConfig *Config
 
 type ConfigGeneral struct {
 	// The root domain where the entire project resides under
+	// Used for links to this server, like the code urls in install links
 	// This includes port and protocol. Examples:
 	// - http://localhost:8080
 	// - https://subdomain.example.com
@@ -37,12 +38,46 @@ type ConfigOauth struct {
 	ClientSecret string `toml:"client_secret"`
 }
 
+type ConfigVersions struct {
+	// Whether version names that aren't semantic versions (like "1.2.3") are accepted
+	// Such versions count as stable and rank below all semantic versions
+	AllowNonSemver bool `toml:"allow_non_semver"`
+}
+
+type ConfigAiScriptRelease struct {
+	Version string `toml:"version"` // The AiScript version, like "0.19.0"
+	Misskey string `toml:"misskey"` // The first Misskey version shipping it, like "2024.8.0"
+}
+
+type ConfigAiScript struct {
+	// Known AiScript releases and which Misskey releases ship them
+	// Replaces the built-in list if set. Plugin versions targeting other AiScript versions count as unknown
+	Releases []ConfigAiScriptRelease `toml:"releases"`
+	// Plugin versions targeting AiScript versions before this one count as legacy. Defaults to "0.17.0"
+	LegacyBefore string `toml:"legacy_before"`
+	// Accept uploaded code without checking its syntax, in case the check rejects valid code
+	SkipSyntaxCheck bool `toml:"skip_syntax_check"`
+}
+
+type ConfigLimits struct {
+	// Largest request body in bytes. Defaults to 64 KiB
+	MaxBodySize int64 `toml:"max_body_size"`
+	// Largest body in bytes for requests uploading code. Defaults to 1 MiB
+	MaxCodeBodySize int64 `toml:"max_code_body_size"`
+}
+
 type Config struct {
 	General ConfigGeneral `toml:"general"`
 	// SSL Config. Required
 	SslConfig ConfigSSL `toml:"ssl"`
 	// OAuth config. Optional
 	OAuthConfig *ConfigOauth `toml:"oauth"`
+	// Plugin version config. Optional
+	Versions ConfigVersions `toml:"versions"`
+	// AiScript compatibility config. Optional
+	AiScript ConfigAiScript `toml:"aiscript"`
+	// Request limits. Optional
+	Limits ConfigLimits `toml:"limits"`
 }
 
 func ReadConfig(fileName *string) (Config, error) {
@@ -0,0 +1,208 @@
+// Package diff creates line based unified diffs, like diff -u or git diff do
+package diff
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Lines of context shown around changes by default
+const DEFAULT_CONTEXT = 3
+
+// How many changed lines are searched for the shortest diff at most
+const MAX_EDITS = 2000
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+// One line of the edit script turning a into b
+type op struct {
+	kind opKind
+	a    int // Index of the line in a. For inserts, how many lines of a come before
+	b    int // Index of the line in b. For deletes, how many lines of b come before
+}
+
+// Create a unified diff between two texts, with the given amount of context lines around changes
+// fromName and toName are used for the "---" and "+++" headers
+// Returns an empty string if both texts are equal
+func Unified(fromName, toName, a, b string, context int) string {
+	linesA := splitLines(a)
+	linesB := splitLines(b)
+	ops := editScript(linesA, linesB)
+
+	builder := strings.Builder{}
+	for _, hunk := range hunks(ops, context) {
+		if builder.Len() == 0 {
+			fmt.Fprintf(&builder, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeHunk(&builder, hunk, linesA, linesB)
+	}
+	return builder.String()
+}
+
+// Split text into lines, keeping the line breaks. A missing break after the last line is kept missing
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Find the shortest edit script turning a into b with the Myers algorithm
+// If the texts differ in more than MAX_EDITS lines, everything gets replaced instead to bound the memory use
+func editScript(a, b []string) []op {
+	n, m := len(a), len(b)
+	limit := min(n+m, MAX_EDITS)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	// For every d, the furthest x reached on the diagonals -d-1 to d+1 before step d
+	trace := [][]int{}
+
+	found := false
+	for d := 0; d <= limit && !found; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return replaceAll(n, m)
+	}
+
+	// Walk back through the trace to collect the edits, last one first
+	ops := []op{}
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		furthest := func(k int) int { return trace[d][k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && furthest(k-1) < furthest(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := furthest(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, op{kind: opEqual, a: x, b: y})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, op{kind: opInsert, a: x, b: y})
+		} else {
+			x--
+			ops = append(ops, op{kind: opDelete, a: x, b: y})
+		}
+	}
+	slices.Reverse(ops)
+	return ops
+}
+
+// An edit script deleting all n lines of a and inserting all m lines of b
+func replaceAll(n, m int) []op {
+	ops := make([]op, 0, n+m)
+	for i := 0; i < n; i++ {
+		ops = append(ops, op{kind: opDelete, a: i})
+	}
+	for i := 0; i < m; i++ {
+		ops = append(ops, op{kind: opInsert, a: n, b: i})
+	}
+	return ops
+}
+
+// Group the edit script into hunks of changes with up to context equal lines around them
+// Changes with at most twice the context of equal lines between them share a hunk, like in GNU diff
+func hunks(ops []op, context int) [][]op {
+	result := [][]op{}
+	start, end := -1, -1
+	for i, o := range ops {
+		if o.kind == opEqual {
+			continue
+		}
+		if start >= 0 && i-end-1 > 2*context {
+			result = append(result, ops[start:min(end+context+1, len(ops))])
+			start = -1
+		}
+		if start < 0 {
+			start = max(i-context, 0)
+		}
+		end = i
+	}
+	if start >= 0 {
+		result = append(result, ops[start:min(end+context+1, len(ops))])
+	}
+	return result
+}
+
+func writeHunk(builder *strings.Builder, hunk []op, a, b []string) {
+	countA, countB := 0, 0
+	for _, o := range hunk {
+		if o.kind != opInsert {
+			countA++
+		}
+		if o.kind != opDelete {
+			countB++
+		}
+	}
+	fmt.Fprintf(builder, "@@ -%s +%s @@\n", hunkRange(hunk[0].a, countA), hunkRange(hunk[0].b, countB))
+	for _, o := range hunk {
+		var prefix byte
+		var line string
+		switch o.kind {
+		case opEqual:
+			prefix, line = ' ', a[o.a]
+		case opDelete:
+			prefix, line = '-', a[o.a]
+		case opInsert:
+			prefix, line = '+', b[o.b]
+		}
+		builder.WriteByte(prefix)
+		builder.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			builder.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// Format the range of a hunk on one side as "start,count", with start counted from 1
+// An empty range starts at the line before it, like GNU diff does
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, count)
+	}
+}
@@ -0,0 +1,180 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// The lines 1 to n, with some of them replaced
+func numberedLines(n int, replaced map[int]string) string {
+	builder := strings.Builder{}
+	for i := 1; i <= n; i++ {
+		if line, ok := replaced[i]; ok {
+			builder.WriteString(line)
+		} else {
+			fmt.Fprint(&builder, i)
+		}
+		builder.WriteByte('\n')
+	}
+	return builder.String()
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    string
+	}{
+		{"both empty", "", "", DEFAULT_CONTEXT, ""},
+		{"equal", "a\nb\n", "a\nb\n", DEFAULT_CONTEXT, ""},
+		{"from empty", "", "x\ny\n", DEFAULT_CONTEXT, "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+x\n+y\n"},
+		{"to empty", "x\ny\n", "", DEFAULT_CONTEXT, "--- a\n+++ b\n@@ -1,2 +0,0 @@\n-x\n-y\n"},
+		{"single line", "x\n", "y\n", DEFAULT_CONTEXT, "--- a\n+++ b\n@@ -1 +1 @@\n-x\n+y\n"},
+		{
+			"final newline added",
+			"a\nb", "a\nb\n", DEFAULT_CONTEXT,
+			"--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			"final newline removed",
+			"a\nb\n", "a\nc", DEFAULT_CONTEXT,
+			"--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n\\ No newline at end of file\n",
+		},
+		{
+			"both without final newline",
+			"a\nb", "a\nc", DEFAULT_CONTEXT,
+			"--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+		{
+			"insertion in the middle",
+			numberedLines(9, nil), numberedLines(9, map[int]string{5: "5\nnew"}), DEFAULT_CONTEXT,
+			"--- a\n+++ b\n@@ -3,6 +3,7 @@\n 3\n 4\n 5\n+new\n 6\n 7\n 8\n",
+		},
+		{
+			"context limited at the edges",
+			numberedLines(3, nil), numberedLines(3, map[int]string{1: "one"}), DEFAULT_CONTEXT,
+			"--- a\n+++ b\n@@ -1,3 +1,3 @@\n-1\n+one\n 2\n 3\n",
+		},
+		{
+			"changes twice the context apart are merged",
+			numberedLines(10, nil), numberedLines(10, map[int]string{2: "two", 9: "nine"}), DEFAULT_CONTEXT,
+			"--- a\n+++ b\n@@ -1,10 +1,10 @@\n 1\n-2\n+two\n 3\n 4\n 5\n 6\n 7\n 8\n-9\n+nine\n 10\n",
+		},
+		{
+			"changes further apart get separate hunks",
+			numberedLines(12, nil), numberedLines(12, map[int]string{2: "two", 10: "ten"}), DEFAULT_CONTEXT,
+			"--- a\n+++ b\n@@ -1,5 +1,5 @@\n 1\n-2\n+two\n 3\n 4\n 5\n@@ -7,6 +7,6 @@\n 7\n 8\n 9\n-10\n+ten\n 11\n 12\n",
+		},
+		{
+			"without context",
+			numberedLines(5, nil), numberedLines(5, map[int]string{2: "two", 4: "four"}), 0,
+			"--- a\n+++ b\n@@ -2 +2 @@\n-2\n+two\n@@ -4 +4 @@\n-4\n+four\n",
+		},
+		{
+			"deletion without context",
+			"a\nb\nc\n", "a\nc\n", 0,
+			"--- a\n+++ b\n@@ -2 +1,0 @@\n-b\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Unified("a", "b", test.a, test.b, test.context); got != test.want {
+				t.Errorf("Unified() =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+// Apply an edit script to a, checking that it only keeps lines that are equal in a and b
+func applyEdits(t *testing.T, ops []op, a, b []string) []string {
+	t.Helper()
+	result := []string{}
+	for _, o := range ops {
+		switch o.kind {
+		case opEqual:
+			if a[o.a] != b[o.b] {
+				t.Fatalf("edit script keeps line %d of a (%q) as line %d of b (%q)", o.a, a[o.a], o.b, b[o.b])
+			}
+			result = append(result, a[o.a])
+		case opInsert:
+			result = append(result, b[o.b])
+		}
+	}
+	return result
+}
+
+func countEdits(ops []op) int {
+	edits := 0
+	for _, o := range ops {
+		if o.kind != opEqual {
+			edits++
+		}
+	}
+	return edits
+}
+
+func TestEditScript(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  string
+		edits int
+	}{
+		{"empty", "", "", 0},
+		{"equal", "a\nb\nc\n", "a\nb\nc\n", 0},
+		{"insert", "a\nc\n", "a\nb\nc\n", 1},
+		{"delete", "a\nb\nc\n", "a\nc\n", 1},
+		{"replace", "a\nb\nc\n", "a\nx\nc\n", 2},
+		{"move", "a\nb\nc\nd\n", "b\nc\nd\na\n", 2},
+		{"repeated lines", "a\nb\na\nb\na\n", "b\na\nb\na\nb\n", 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := splitLines(test.a), splitLines(test.b)
+			ops := editScript(a, b)
+			if got := strings.Join(applyEdits(t, ops, a, b), ""); got != test.b {
+				t.Errorf("applying the edit script gives %q, want %q", got, test.b)
+			}
+			if edits := countEdits(ops); edits != test.edits {
+				t.Errorf("edit script has %d edits, want %d", edits, test.edits)
+			}
+		})
+	}
+}
+
+func TestEditScriptFallsBackAfterMaxEdits(t *testing.T) {
+	// A shared first line and n different lines on each side take 2n edits
+	lines := func(prefix string, n int) []string {
+		result := []string{"same\n"}
+		for i := 0; i < n; i++ {
+			result = append(result, fmt.Sprintf("%s%d\n", prefix, i))
+		}
+		return result
+	}
+	tests := []struct {
+		name     string
+		n        int
+		fallback bool
+	}{
+		{"at the limit", MAX_EDITS / 2, false},
+		{"over the limit", MAX_EDITS/2 + 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := lines("a", test.n), lines("b", test.n)
+			ops := editScript(a, b)
+			if got := applyEdits(t, ops, a, b); strings.Join(got, "") != strings.Join(b, "") {
+				t.Errorf("applying the edit script doesn't give b")
+			}
+			wantEdits := 2 * test.n
+			if test.fallback {
+				// Everything is replaced, including the shared line
+				wantEdits = len(a) + len(b)
+			}
+			if edits := countEdits(ops); edits != wantEdits {
+				t.Errorf("edit script has %d edits, want %d", edits, wantEdits)
+			}
+		})
+	}
+}
@@ -4,6 +4,9 @@ go 1.22.1
 
 require (
 	github.com/BurntSushi/toml v1.3.2
+	github.com/alexedwards/argon2id v1.0.0
+	github.com/justinas/nosurf v1.1.1
+	github.com/rs/cors v1.11.0
 	github.com/sirupsen/logrus v1.9.3
 	github.com/volatiletech/authboss-clientstate v0.0.0-20230313034706-0b930a6c0713
 	github.com/volatiletech/authboss-renderer v0.0.0-20210622044114-b32bb7a1387f
@@ -14,12 +17,7 @@ require (
 	gorm.io/gorm v1.25.9
 )
 
-require (
-	cloud.google.com/go/compute v1.20.1 // indirect
-	github.com/alexedwards/argon2id v1.0.0 // indirect
-	github.com/justinas/nosurf v1.1.1 // indirect
-	github.com/rs/cors v1.11.0 // indirect
-)
+require cloud.google.com/go/compute v1.20.1 // indirect
 
 require (
 	cloud.google.com/go/compute/metadata v0.2.3 // indirect
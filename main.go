@@ -9,6 +9,7 @@ import (
 	_ "github.com/volatiletech/authboss-renderer"
 	abrenderer "github.com/volatiletech/authboss-renderer"
 
+	"github.com/mstarongithub/mk-plugin-repo/auth"
 	_ "github.com/mstarongithub/mk-plugin-repo/auth-old"
 	authold "github.com/mstarongithub/mk-plugin-repo/auth-old"
 	"github.com/mstarongithub/mk-plugin-repo/config"
@@ -49,10 +50,15 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	authManager, err := auth.NewAuthManager(&store)
+	if err != nil {
+		panic(err)
+	}
 	httpServer, err := server.NewServer(
 		fswrapper.NewFSWrapper(frontendFS, "frontend/build/", false),
 		ab,
 		&store,
+		authManager,
 	)
 	if err != nil {
 		panic(err)
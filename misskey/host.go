@@ -0,0 +1,94 @@
+// Package misskey talks to Misskey instances and forks of it and builds links into them
+package misskey
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Longest host name DNS allows
+const MAX_HOST_LENGTH = 253
+
+var ErrInvalidHost = errors.New("not a valid instance host")
+
+// Normalise what a user entered as their instance into a bare host, like "misskey.example"
+// Accepts a leading "https://" and a trailing slash, upper case letters and the default port.
+// Other ports are kept. IP addresses, single label names and anything with a path are rejected
+// International domain names must be given in their punycode form ("xn--...")
+func NormaliseHost(input string) (string, error) {
+	host := strings.TrimSpace(input)
+	if scheme, rest, found := strings.Cut(host, "://"); found {
+		if !strings.EqualFold(scheme, "https") {
+			return "", fmt.Errorf("%w: instances must use https", ErrInvalidHost)
+		}
+		host = rest
+	}
+	host = strings.TrimSuffix(host, "/")
+	if strings.ContainsAny(host, "/?#@\\") {
+		return "", fmt.Errorf("%w: must be a host, not a url", ErrInvalidHost)
+	}
+	host = strings.ToLower(host)
+
+	name, port := host, ""
+	if i := strings.LastIndexByte(host, ':'); i >= 0 {
+		name, port = host[:i], host[i+1:]
+		portNr, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || portNr == 0 {
+			return "", fmt.Errorf("%w: bad port", ErrInvalidHost)
+		}
+		if portNr == 443 {
+			port = ""
+		} else {
+			port = strconv.FormatUint(portNr, 10)
+		}
+	}
+	name = strings.TrimSuffix(name, ".")
+	if err := checkHostName(name); err != nil {
+		return "", err
+	}
+	if port != "" {
+		return net.JoinHostPort(name, port), nil
+	}
+	return name, nil
+}
+
+// Check that a name is a public DNS name made of letters, digits and dashes
+func checkHostName(name string) error {
+	if name == "" || len(name) > MAX_HOST_LENGTH {
+		return fmt.Errorf("%w: bad length", ErrInvalidHost)
+	}
+	if net.ParseIP(strings.Trim(name, "[]")) != nil {
+		return fmt.Errorf("%w: ip addresses are not allowed", ErrInvalidHost)
+	}
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return fmt.Errorf("%w: must be a fully qualified domain name", ErrInvalidHost)
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("%w: bad domain label", ErrInvalidHost)
+		}
+		for _, r := range label {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+				return fmt.Errorf(
+					"%w: only letters, digits and dashes are allowed. Use punycode for international names",
+					ErrInvalidHost,
+				)
+			}
+		}
+	}
+	// The top level domain can't be all digits, so that things like "10.1" aren't taken for names
+	if _, err := strconv.Atoi(labels[len(labels)-1]); err == nil {
+		return fmt.Errorf("%w: numeric top level domain", ErrInvalidHost)
+	}
+	return nil
+}
+
+// Base url of an instance, like "https://misskey.example"
+func instanceUrl(host string) *url.URL {
+	return &url.URL{Scheme: "https", Host: host}
+}
@@ -0,0 +1,127 @@
+package misskey
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// How a plugin gets installed on an instance
+const (
+	// One click via the instance's /install-extensions page, which fetches and checks the install payload itself
+	INSTALL_METHOD_EXTENSIONS = "install-extensions"
+	// The code has to be pasted into the instance's plugin install page
+	INSTALL_METHOD_PASTE = "paste"
+	// The code has to be pasted into an "AiScript App" widget. There is no page for it to link to
+	INSTALL_METHOD_WIDGET = "widget"
+)
+
+// Names Misskey and its forks announce in their nodeinfo. Only those can run AiScript plugins
+var misskeyFamily = []string{
+	"misskey",
+	"sharkey",
+	"cherrypick",
+	"firefish",
+	"calckey",
+	"iceshrimp",
+	"foundkey",
+	"meisskey",
+	"catodon",
+	"magnetar",
+	"areionskey",
+	"nexkey",
+}
+
+// Whether the software is Misskey or a fork of it
+func IsMisskeyFamily(software *Software) bool {
+	return slices.Contains(misskeyFamily, software.Name)
+}
+
+// First version of each software with the /install-extensions page
+// Other software, including unknown forks, gets the plugin install page instead
+var installExtensionsSince = map[string][]int{
+	"misskey": {2024, 3, 1},
+	"sharkey": {2024, 3, 1},
+}
+
+// Whether the software has the /install-extensions page
+func SupportsInstallExtensions(software *Software) bool {
+	since, ok := installExtensionsSince[software.Name]
+	if !ok {
+		return false
+	}
+	version := leadingNumbers(software.Version)
+	for i, minimum := range since {
+		if i >= len(version) || version[i] < minimum {
+			return false
+		}
+		if version[i] > minimum {
+			return true
+		}
+	}
+	return true
+}
+
+// The numeric parts at the start of a version, like [2024 5 0] for "2024.5.0-beta.1"
+func leadingNumbers(version string) []int {
+	numbers := []int{}
+	for _, part := range strings.Split(version, ".") {
+		end := strings.IndexFunc(part, func(r rune) bool { return r < '0' || r > '9' })
+		if end == 0 {
+			break
+		}
+		if end < 0 {
+			end = len(part)
+		}
+		number, err := strconv.Atoi(part[:end])
+		if err != nil {
+			break
+		}
+		numbers = append(numbers, number)
+		if end < len(part) {
+			break
+		}
+	}
+	return numbers
+}
+
+// Resource type of plugins in install payloads
+const PAYLOAD_TYPE_PLUGIN = "plugin"
+
+// What the /install-extensions page fetches: a JSON5 object with the type of the resource and its code
+type installPayload struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+// Build the payload the /install-extensions page fetches to install a plugin with the given code
+// Plain JSON is valid JSON5, so it is sent as such
+func InstallPayload(code string) ([]byte, error) {
+	return json.Marshal(&installPayload{Type: PAYLOAD_TYPE_PLUGIN, Data: code})
+}
+
+// Hex encoded SHA-512 hash of an install payload. The /install-extensions page refuses payloads not matching it
+func PayloadHash(payload []byte) string {
+	sum := sha512.Sum512(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// Link to install a plugin on an instance, and the method it uses
+// payloadUrl is where the install payload of the plugin can be fetched and payloadHash its PayloadHash
+// The link is empty for widgets, since those can't be installed via link
+func InstallLink(host string, software *Software, isWidget bool, payloadUrl, payloadHash string) (method, link string) {
+	switch {
+	case isWidget:
+		return INSTALL_METHOD_WIDGET, ""
+	case software != nil && SupportsInstallExtensions(software):
+		target := instanceUrl(host).JoinPath("install-extensions")
+		target.RawQuery = url.Values{"url": {payloadUrl}, "hash": {payloadHash}}.Encode()
+		return INSTALL_METHOD_EXTENSIONS, target.String()
+	default:
+		return INSTALL_METHOD_PASTE, instanceUrl(host).JoinPath("settings", "plugin", "install").String()
+	}
+}
@@ -0,0 +1,123 @@
+package misskey
+
+import (
+	"encoding/json"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestSupportsInstallExtensions(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    bool
+	}{
+		{"misskey", "2024.3.1", true},
+		{"misskey", "2024.3.1-beta.1", true},
+		{"misskey", "2024.3.2", true},
+		{"misskey", "2024.10.0", true},
+		{"misskey", "2025.1.0", true},
+		{"misskey", "2024.3.0", false},
+		{"misskey", "2024.2.0", false},
+		{"misskey", "2023.12.2", false},
+		{"misskey", "2024.3", false},
+		{"misskey", "", false},
+		{"misskey", "unknown", false},
+		{"sharkey", "2024.3.1", true},
+		{"sharkey", "2024.8.2.1", true},
+		{"sharkey", "2023.12.1", false},
+		{"cherrypick", "4.11.1", false},
+		{"firefish", "1.0.4", false},
+		{"somefork", "2025.1.0", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name+" "+test.version, func(t *testing.T) {
+			software := &Software{Name: test.name, Version: test.version}
+			if got := SupportsInstallExtensions(software); got != test.want {
+				t.Errorf("SupportsInstallExtensions() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLeadingNumbers(t *testing.T) {
+	tests := []struct {
+		version string
+		want    []int
+	}{
+		{"", []int{}},
+		{"2024.5.0", []int{2024, 5, 0}},
+		{"2024.5.0-beta.1", []int{2024, 5, 0}},
+		{"2024.3.1+fork.2", []int{2024, 3, 1}},
+		{"2024.8.2.1", []int{2024, 8, 2, 1}},
+		{"13", []int{13}},
+		{"1.2rc3.4", []int{1, 2}},
+		{"v2024.5.0", []int{}},
+		{"2024..5", []int{2024}},
+	}
+	for _, test := range tests {
+		if got := leadingNumbers(test.version); !slices.Equal(got, test.want) {
+			t.Errorf("leadingNumbers(%q) = %v, want %v", test.version, got, test.want)
+		}
+	}
+}
+
+func TestInstallLink(t *testing.T) {
+	modern := &Software{Name: "misskey", Version: "2024.5.0"}
+	old := &Software{Name: "misskey", Version: "2023.12.0"}
+	payloadUrl := "https://repo.example/api/v1/plugins/1/1.0.0/install.json5"
+	tests := []struct {
+		name       string
+		software   *Software
+		isWidget   bool
+		wantMethod string
+		wantLink   string
+	}{
+		{
+			"install extensions",
+			modern, false,
+			INSTALL_METHOD_EXTENSIONS,
+			"https://misskey.example/install-extensions?hash=abc&url=" + url.QueryEscape(payloadUrl),
+		},
+		{"old version", old, false, INSTALL_METHOD_PASTE, "https://misskey.example/settings/plugin/install"},
+		{"unknown software", nil, false, INSTALL_METHOD_PASTE, "https://misskey.example/settings/plugin/install"},
+		{"widget", modern, true, INSTALL_METHOD_WIDGET, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			method, link := InstallLink("misskey.example", test.software, test.isWidget, payloadUrl, "abc")
+			if method != test.wantMethod || link != test.wantLink {
+				t.Errorf("InstallLink() = %q, %q, want %q, %q", method, link, test.wantMethod, test.wantLink)
+			}
+		})
+	}
+}
+
+func TestInstallPayload(t *testing.T) {
+	code := "### { name: \"<x>\" }\r\n<: `a & b`\n"
+	payload, err := InstallPayload(code)
+	if err != nil {
+		t.Fatalf("InstallPayload() error = %v", err)
+	}
+	decoded := installPayload{}
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		t.Fatalf("payload %s isn't valid JSON: %v", payload, err)
+	}
+	if decoded.Type != PAYLOAD_TYPE_PLUGIN || decoded.Data != code {
+		t.Errorf("payload = %+v, want the plugin type and the code", decoded)
+	}
+	// The hash is compared against the payload with CRLF line breaks normalised, so there must be none
+	if slices.Contains(payload, '\r') || slices.Contains(payload, '\n') {
+		t.Errorf("payload %q contains raw line breaks", payload)
+	}
+}
+
+func TestPayloadHash(t *testing.T) {
+	// SHA-512 of "abc" from FIPS 180-2
+	want := "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a" +
+		"2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f"
+	if got := PayloadHash([]byte("abc")); got != want {
+		t.Errorf("PayloadHash() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,195 @@
+package misskey
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// How long fetching the software of an instance may take at most
+const FETCH_TIMEOUT = 5 * time.Second
+
+// Largest nodeinfo document that is read
+const MAX_NODEINFO_SIZE = 64 * 1024
+
+// Nodeinfo schemas that are understood, preferred first
+var nodeinfoSchemas = []string{
+	"http://nodeinfo.diaspora.software/ns/schema/2.1",
+	"http://nodeinfo.diaspora.software/ns/schema/2.0",
+}
+
+// The software an instance runs, as announced in its nodeinfo
+type Software struct {
+	Name    string // Lower case name, like "misskey" or "sharkey"
+	Version string // Version as the software reports it, like "2024.5.0"
+}
+
+var ErrNoNodeinfo = errors.New("instance doesn't provide nodeinfo")
+var ErrForbiddenAddress = errors.New("instance resolves to a non-public address")
+
+// Client used for all requests to instances
+// Only connects to public addresses, so that user given hosts can't reach internal services
+var httpClient = &http.Client{
+	Timeout: FETCH_TIMEOUT,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: FETCH_TIMEOUT,
+			Control: onlyPublicAddresses,
+		}).DialContext,
+		TLSHandshakeTimeout: FETCH_TIMEOUT,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return errors.New("too many redirects")
+		}
+		return nil
+	},
+}
+
+// Address ranges instances must not resolve to
+// The IANA special-purpose address registries, plus multicast. See
+// https://www.iana.org/assignments/iana-ipv4-special-registry and
+// https://www.iana.org/assignments/iana-ipv6-special-registry
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "This network"
+	netip.MustParsePrefix("10.0.0.0/8"),      // Private
+	netip.MustParsePrefix("100.64.0.0/10"),   // Shared address space (CGNAT)
+	netip.MustParsePrefix("127.0.0.0/8"),     // Loopback
+	netip.MustParsePrefix("169.254.0.0/16"),  // Link local
+	netip.MustParsePrefix("172.16.0.0/12"),   // Private
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentation (TEST-NET-1)
+	netip.MustParsePrefix("192.31.196.0/24"), // AS112-v4
+	netip.MustParsePrefix("192.52.193.0/24"), // AMT
+	netip.MustParsePrefix("192.88.99.0/24"),  // Deprecated 6to4 relay anycast
+	netip.MustParsePrefix("192.168.0.0/16"),  // Private
+	netip.MustParsePrefix("192.175.48.0/24"), // Direct delegation AS112 service
+	netip.MustParsePrefix("198.18.0.0/15"),   // Benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentation (TEST-NET-2)
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentation (TEST-NET-3)
+	netip.MustParsePrefix("224.0.0.0/4"),     // Multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // Reserved, including the limited broadcast address
+	netip.MustParsePrefix("::/128"),          // Unspecified
+	netip.MustParsePrefix("::1/128"),         // Loopback
+	netip.MustParsePrefix("::ffff:0:0/96"),   // IPv4-mapped, checked against the IPv4 ranges instead
+	netip.MustParsePrefix("64:ff9b::/96"),    // IPv4-IPv6 translation
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // Local-use IPv4-IPv6 translation
+	netip.MustParsePrefix("100::/64"),        // Discard-only
+	netip.MustParsePrefix("2001::/23"),       // IETF protocol assignments, including Teredo
+	netip.MustParsePrefix("2001:db8::/32"),   // Documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4
+	netip.MustParsePrefix("3fff::/20"),       // Documentation
+	netip.MustParsePrefix("5f00::/16"),       // Segment routing SIDs
+	netip.MustParsePrefix("fc00::/7"),        // Unique local
+	netip.MustParsePrefix("fe80::/10"),       // Link local
+	netip.MustParsePrefix("ff00::/8"),        // Multicast
+}
+
+func onlyPublicAddresses(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !isPublicAddress(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// Whether an address is outside of all forbidden ranges
+func isPublicAddress(ip netip.Addr) bool {
+	// IPv4-mapped IPv6 addresses reach the IPv4 address they contain
+	ip = ip.WithZone("").Unmap()
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Find out what software an instance runs via nodeinfo
+// host must already be normalised with NormaliseHost
+func FetchSoftware(ctx context.Context, host string) (*Software, error) {
+	wellKnown := instanceUrl(host).JoinPath(".well-known", "nodeinfo")
+	links := struct {
+		Links []struct {
+			Rel  string `json:"rel"`
+			Href string `json:"href"`
+		} `json:"links"`
+	}{}
+	if err := getJson(ctx, wellKnown.String(), &links); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNoNodeinfo, err)
+	}
+	href := ""
+	for _, schema := range nodeinfoSchemas {
+		for _, link := range links.Links {
+			if link.Rel == schema {
+				href = link.Href
+				break
+			}
+		}
+		if href != "" {
+			break
+		}
+	}
+	if href == "" {
+		return nil, fmt.Errorf("%w: no supported schema", ErrNoNodeinfo)
+	}
+	// The document has to be on the instance itself
+	target, err := url.Parse(href)
+	if err != nil || target.Scheme != "https" || target.Host != host {
+		return nil, fmt.Errorf("%w: nodeinfo link %q points elsewhere", ErrNoNodeinfo, href)
+	}
+
+	nodeinfo := struct {
+		Software struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"software"`
+	}{}
+	if err = getJson(ctx, target.String(), &nodeinfo); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNoNodeinfo, err)
+	}
+	if nodeinfo.Software.Name == "" {
+		return nil, fmt.Errorf("%w: no software name", ErrNoNodeinfo)
+	}
+	return &Software{
+		Name:    strings.ToLower(nodeinfo.Software.Name),
+		Version: nodeinfo.Software.Version,
+	}, nil
+}
+
+func getJson(ctx context.Context, target string, into any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("got status %d from %s", res.StatusCode, target)
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, MAX_NODEINFO_SIZE))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", target, err)
+	}
+	if err = json.Unmarshal(body, into); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", target, err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package misskey
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{"1.1.1.1", true},
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"2a01:4f8::1", true},
+		{"::ffff:8.8.8.8", true},
+
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"10.1.2.3", false},
+		{"100.64.0.1", false},
+		{"100.127.255.255", false},
+		{"127.0.0.1", false},
+		{"169.254.169.254", false},
+		{"172.16.0.1", false},
+		{"172.31.255.255", false},
+		{"192.0.0.8", false},
+		{"192.0.2.1", false},
+		{"192.88.99.1", false},
+		{"192.168.1.1", false},
+		{"198.18.0.1", false},
+		{"198.19.255.255", false},
+		{"198.51.100.1", false},
+		{"203.0.113.1", false},
+		{"224.0.0.1", false},
+		{"240.0.0.1", false},
+		{"255.255.255.255", false},
+
+		{"::", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"64:ff9b::a00:1", false},
+		{"100::1", false},
+		{"2001::1", false},             // Teredo
+		{"2001:0:4136:e378::1", false}, // Teredo
+		{"2001:db8::1", false},
+		{"2002:a00:1::1", false}, // 6to4 wrapping 10.0.0.1
+		{"2002:808:808::1", false},
+		{"fc00::1", false},
+		{"fd12:3456::1", false},
+		{"fe80::1", false},
+		{"fe80::1%eth0", false},
+		{"ff02::1", false},
+	}
+	for _, test := range tests {
+		t.Run(test.address, func(t *testing.T) {
+			if got := isPublicAddress(netip.MustParseAddr(test.address)); got != test.want {
+				t.Errorf("isPublicAddress() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestOnlyPublicAddresses(t *testing.T) {
+	tests := []struct {
+		address string
+		wantErr error
+	}{
+		{"1.1.1.1:443", nil},
+		{"[2606:4700:4700::1111]:443", nil},
+		{"127.0.0.1:443", ErrForbiddenAddress},
+		{"[::ffff:127.0.0.1]:443", ErrForbiddenAddress},
+		{"[fe80::1%eth0]:443", ErrForbiddenAddress},
+		{"misskey.example:443", ErrForbiddenAddress},
+	}
+	for _, test := range tests {
+		t.Run(test.address, func(t *testing.T) {
+			if err := onlyPublicAddresses("tcp", test.address, nil); !errors.Is(err, test.wantErr) {
+				t.Errorf("onlyPublicAddresses() = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+	if err := onlyPublicAddresses("tcp", "1.1.1.1", nil); err == nil {
+		t.Errorf("onlyPublicAddresses() without port = nil, want an error")
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gitlab.com/mstarongitlab/goutils/sliceutils"
+
+	"github.com/mstarongithub/mk-plugin-repo/storage"
+)
+
+// Data expected for creating a new access token via POST /api/v1/tokens
+type NewAccessTokenData struct {
+	Name          string   `json:"name"`            // A name to identify the token by
+	Scopes        []string `json:"scopes"`          // What the token is allowed to do
+	ExpiresInDays *uint    `json:"expires_in_days"` // After how many days the token expires. Never if not set
+}
+
+func (data *NewAccessTokenData) validate() *ApiError {
+	if data.Name == "" {
+		return missingField("name")
+	}
+	if len(data.Scopes) == 0 {
+		return missingField("scopes")
+	}
+	return nil
+}
+
+// Data returned about an access token. The secret is never included
+type AccessTokenInfo struct {
+	ID        uint       `json:"id"`         // The ID of the token
+	Name      string     `json:"name"`       // The name of the token
+	Scopes    []string   `json:"scopes"`     // What the token is allowed to do
+	CreatedAt time.Time  `json:"created_at"` // When the token was created
+	ExpiresAt *time.Time `json:"expires_at"` // When the token expires. Null if never
+	LastUsed  *time.Time `json:"last_used"`  // When the token was last used. Null if never
+}
+
+// Data returned when creating a new access token
+type NewAccessTokenResponse struct {
+	AccessTokenInfo
+	Token string `json:"token"` // The full token. Only ever shown once
+}
+
+// GET /api/v1/tokens
+// RESTRICTED, session only
+// Get all access tokens of the current account
+// Returns a json array of AccessTokenInfo
+func getAccessTokens(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("getAccessTokens: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	acc := AccountFromRequest(r)
+	tokens, err := store.GetAccessTokensFor(acc.ID)
+	if err != nil {
+		logrus.WithError(err).WithField("accountID", acc.ID).Errorln("Failed to get access tokens")
+		writeError(w, "failed to get access tokens", http.StatusInternalServerError)
+		return
+	}
+	infos := sliceutils.Map(tokens, func(t storage.AccessToken) AccessTokenInfo {
+		return dbAccessTokenToAccessTokenInfo(&t)
+	})
+	jbody, err := json.Marshal(infos)
+	if err != nil {
+		logrus.WithError(err).Errorln("getAccessTokens: Failed to marshal tokens")
+		writeError(w, "json encoding failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jbody)
+}
+
+// POST /api/v1/tokens
+// RESTRICTED, session only
+// Create a new access token for the current account
+// Body must be a json-encoded NewAccessTokenData
+// Returns a NewAccessTokenResponse. The token itself can't be retrieved again later
+func newAccessToken(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("newAccessToken: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	acc := AccountFromRequest(r)
+	data := NewAccessTokenData{}
+	if !decodeBody(w, r, &data, maxBodySize(false)) {
+		return
+	}
+	var expiresAt *time.Time
+	if data.ExpiresInDays != nil {
+		exp := time.Now().AddDate(0, 0, int(*data.ExpiresInDays))
+		expiresAt = &exp
+	}
+
+	token, tokenString, err := store.NewAccessToken(acc.ID, data.Name, data.Scopes, expiresAt)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidScope) {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logrus.WithError(err).WithField("accountID", acc.ID).Errorln("Failed to create access token")
+		writeError(w, "failed to create access token", http.StatusInternalServerError)
+		return
+	}
+	jbody, err := json.Marshal(&NewAccessTokenResponse{
+		AccessTokenInfo: dbAccessTokenToAccessTokenInfo(token),
+		Token:           tokenString,
+	})
+	if err != nil {
+		logrus.WithError(err).Errorln("newAccessToken: Failed to marshal token")
+		writeError(w, "json encoding failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jbody)
+}
+
+// DELETE /api/v1/tokens/{tokenId}
+// RESTRICTED, session only
+// Revoke an access token of the current account
+func revokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("revokeAccessToken: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	acc := AccountFromRequest(r)
+	tokenID, err := strconv.ParseUint(r.PathValue("tokenId"), 10, 0)
+	if err != nil {
+		writeError(w, "bad token id. Must be a uint", http.StatusBadRequest)
+		return
+	}
+	if err = store.RevokeAccessToken(acc.ID, uint(tokenID)); err != nil {
+		if errors.Is(err, storage.ErrAccessTokenNotFound) {
+			writeError(w, "access token not found", http.StatusNotFound)
+			return
+		}
+		logrus.WithError(err).WithField("tokenID", tokenID).Errorln("Failed to revoke access token")
+		writeError(w, "failed to revoke access token", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,326 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gitlab.com/mstarongitlab/goutils/sliceutils"
+
+	"github.com/mstarongithub/mk-plugin-repo/storage"
+)
+
+// Data expected for rejecting a plugin, version or account
+// via POST /api/v1/admin/queue/{pluginId}/reject, POST /api/v1/admin/versions/{pluginId}/{versionName}/reject
+// or POST /api/v1/admin/accounts/{accountId}/reject
+type RejectionData struct {
+	Reason string `json:"reason"` // Why the plugin or account was rejected
+}
+
+func (data *RejectionData) validate() *ApiError {
+	if data.Reason == "" {
+		return missingField("reason")
+	}
+	return nil
+}
+
+// Data about an account waiting for approval. Only visible to account moderators
+type PendingAccountInfo struct {
+	AccountInfo
+	Mail      string    `json:"mail"`       // The mail address the account registered with
+	CreatedAt time.Time `json:"created_at"` // When the account registered
+}
+
+// GET /api/v1/admin/queue
+// RESTRICTED, moderators only
+// Get all plugins waiting for approval, oldest first
+// Returns a json array of Plugin
+func getPluginQueue(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("getPluginQueue: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	dbPlugins, err := store.GetPendingPlugins()
+	if err != nil {
+		logrus.WithError(err).Errorln("Failed to get plugin queue")
+		writeError(w, "failed to get plugin queue", http.StatusInternalServerError)
+		return
+	}
+	apiPlugins := sliceutils.Map(dbPlugins, func(p storage.Plugin) Plugin {
+		return dbPluginToApiPlugin(&p)
+	})
+	jbody, err := json.Marshal(apiPlugins)
+	if err != nil {
+		logrus.WithError(err).Errorln("getPluginQueue: Failed to marshal plugins")
+		writeError(w, "json encoding failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jbody)
+}
+
+// POST /api/v1/admin/queue/{pluginId}/approve
+// RESTRICTED, moderators only
+// Approve a plugin, making it publicly available
+func approvePlugin(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("approvePlugin: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	pluginID, err := strconv.ParseUint(r.PathValue("pluginId"), 10, 0)
+	if err != nil {
+		writeError(w, "bad plugin id. Must be a uint", http.StatusBadRequest)
+		return
+	}
+	err = store.ApprovePlugin(uint(pluginID), AccountFromRequest(r))
+	writePluginReviewError(w, err, uint(pluginID))
+}
+
+// POST /api/v1/admin/queue/{pluginId}/reject
+// RESTRICTED, moderators only
+// Reject a plugin. Body must be a json-encoded RejectionData with a non-empty reason
+func rejectPlugin(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("rejectPlugin: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	pluginID, err := strconv.ParseUint(r.PathValue("pluginId"), 10, 0)
+	if err != nil {
+		writeError(w, "bad plugin id. Must be a uint", http.StatusBadRequest)
+		return
+	}
+	data := RejectionData{}
+	if !decodeBody(w, r, &data, maxBodySize(false)) {
+		return
+	}
+	err = store.RejectPlugin(uint(pluginID), AccountFromRequest(r), data.Reason)
+	writePluginReviewError(w, err, uint(pluginID))
+}
+
+// Write the appropriate response for an error from approving or rejecting a plugin
+// Does nothing if err is nil
+func writePluginReviewError(w http.ResponseWriter, err error, pluginID uint) {
+	switch {
+	case err == nil:
+	case errors.Is(err, storage.ErrPluginNotFound):
+		writeError(w, "plugin not found", http.StatusNotFound)
+	case errors.Is(err, storage.ErrUnauthorised):
+		writeError(w, "only plugin moderators can do this", http.StatusForbidden)
+	default:
+		logrus.WithError(err).WithField("pluginID", pluginID).Errorln("Failed to review plugin")
+		writeError(w, "failed to review plugin", http.StatusInternalServerError)
+	}
+}
+
+// Data about a version held for review because it requests more permissions
+type HeldVersionInfo struct {
+	PluginID        uint      `json:"plugin_id"`        // ID of the plugin the version belongs to
+	VersionName     string    `json:"version_name"`     // Name of the version
+	AiScriptVersion string    `json:"aiscript_version"` // The AiScript version the version targets
+	Permissions     []string  `json:"permissions"`      // All permissions the version requests
+	RiskLevel       string    `json:"risk_level"`       // How risky the requested permissions are
+	CreatedAt       time.Time `json:"created_at"`       // When the version was uploaded
+	PermissionChanges
+}
+
+// GET /api/v1/admin/versions
+// RESTRICTED, moderators only
+// Get all versions held for review because they request more permissions than the previous one, oldest first
+// Returns a json array of HeldVersionInfo
+func getHeldVersions(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("getHeldVersions: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	versions, err := store.GetHeldVersions()
+	if err != nil {
+		logrus.WithError(err).Errorln("Failed to get held versions")
+		writeError(w, "failed to get held versions", http.StatusInternalServerError)
+		return
+	}
+	infos := sliceutils.Map(versions, func(v storage.PluginVersion) HeldVersionInfo {
+		return HeldVersionInfo{
+			PluginID:          v.PluginID,
+			VersionName:       v.Version,
+			AiScriptVersion:   v.AiScriptVersion,
+			Permissions:       v.Permissions,
+			RiskLevel:         v.RiskLevel,
+			CreatedAt:         v.CreatedAt,
+			PermissionChanges: dbVersionToPermissionChanges(&v),
+		}
+	})
+	jbody, err := json.Marshal(infos)
+	if err != nil {
+		logrus.WithError(err).Errorln("getHeldVersions: Failed to marshal versions")
+		writeError(w, "json encoding failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jbody)
+}
+
+// POST /api/v1/admin/versions/{pluginId}/{versionName}/approve
+// RESTRICTED, moderators only
+// Approve a held version. It becomes the current version of its plugin if it is the highest stable one
+// 403 if the moderator uploaded the version or authors or maintains its plugin
+func approveVersion(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("approveVersion: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	pluginID, err := strconv.ParseUint(r.PathValue("pluginId"), 10, 0)
+	if err != nil {
+		writeError(w, "bad plugin id. Must be a uint", http.StatusBadRequest)
+		return
+	}
+	versionName := r.PathValue("versionName")
+	err = store.ApproveVersion(uint(pluginID), versionName, AccountFromRequest(r))
+	writeVersionReviewError(w, err, uint(pluginID), versionName)
+}
+
+// POST /api/v1/admin/versions/{pluginId}/{versionName}/reject
+// RESTRICTED, moderators only
+// Reject a held version, hiding it. Body must be a json-encoded RejectionData with a non-empty reason
+// 403 if the moderator uploaded the version or authors or maintains its plugin
+func rejectVersion(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("rejectVersion: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	pluginID, err := strconv.ParseUint(r.PathValue("pluginId"), 10, 0)
+	if err != nil {
+		writeError(w, "bad plugin id. Must be a uint", http.StatusBadRequest)
+		return
+	}
+	versionName := r.PathValue("versionName")
+	data := RejectionData{}
+	if !decodeBody(w, r, &data, maxBodySize(false)) {
+		return
+	}
+	err = store.RejectVersion(uint(pluginID), versionName, AccountFromRequest(r), data.Reason)
+	writeVersionReviewError(w, err, uint(pluginID), versionName)
+}
+
+// Write the appropriate response for an error from approving or rejecting a held version
+// Does nothing if err is nil
+func writeVersionReviewError(w http.ResponseWriter, err error, pluginID uint, versionName string) {
+	switch {
+	case err == nil:
+	case errors.Is(err, storage.ErrVersionNotFound), errors.Is(err, storage.ErrPluginNotFound):
+		writeError(w, "no such version waiting for review", http.StatusNotFound)
+	case errors.Is(err, storage.ErrUnauthorised):
+		writeError(w, "only plugin moderators not uploading or maintaining the version can review it", http.StatusForbidden)
+	default:
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"pluginID":    pluginID,
+			"versionName": versionName,
+		}).Errorln("Failed to review version")
+		writeError(w, "failed to review version", http.StatusInternalServerError)
+	}
+}
+
+// GET /api/v1/admin/accounts
+// RESTRICTED, account moderators only
+// Get all accounts waiting for approval, oldest first
+// Returns a json array of PendingAccountInfo
+func getAccountQueue(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("getAccountQueue: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	accounts, err := store.GetPendingAccounts()
+	if err != nil {
+		logrus.WithError(err).Errorln("Failed to get account queue")
+		writeError(w, "failed to get account queue", http.StatusInternalServerError)
+		return
+	}
+	infos := sliceutils.Map(accounts, func(acc storage.Account) PendingAccountInfo {
+		return PendingAccountInfo{
+			AccountInfo: dbAccountToAccountInfo(&acc),
+			Mail:        acc.Mail,
+			CreatedAt:   acc.CreatedAt,
+		}
+	})
+	jbody, err := json.Marshal(infos)
+	if err != nil {
+		logrus.WithError(err).Errorln("getAccountQueue: Failed to marshal accounts")
+		writeError(w, "json encoding failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jbody)
+}
+
+// POST /api/v1/admin/accounts/{accountId}/approve
+// RESTRICTED, account moderators only
+// Approve an account, allowing it to publish plugins
+func approveAccount(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("approveAccount: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	accountID, err := strconv.ParseUint(r.PathValue("accountId"), 10, 0)
+	if err != nil {
+		writeError(w, "bad account id. Must be a uint", http.StatusBadRequest)
+		return
+	}
+	err = store.ApproveAccount(uint(accountID), AccountFromRequest(r))
+	writeAccountReviewError(w, err, uint(accountID))
+}
+
+// POST /api/v1/admin/accounts/{accountId}/reject
+// RESTRICTED, account moderators only
+// Reject an account. Body must be a json-encoded RejectionData with a non-empty reason
+func rejectAccount(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("rejectAccount: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	accountID, err := strconv.ParseUint(r.PathValue("accountId"), 10, 0)
+	if err != nil {
+		writeError(w, "bad account id. Must be a uint", http.StatusBadRequest)
+		return
+	}
+	data := RejectionData{}
+	if !decodeBody(w, r, &data, maxBodySize(false)) {
+		return
+	}
+	err = store.RejectAccount(uint(accountID), AccountFromRequest(r), data.Reason)
+	writeAccountReviewError(w, err, uint(accountID))
+}
+
+// Write the appropriate response for an error from approving or rejecting an account
+// Does nothing if err is nil
+func writeAccountReviewError(w http.ResponseWriter, err error, accountID uint) {
+	switch {
+	case err == nil:
+	case errors.Is(err, storage.ErrAccountNotFound):
+		writeError(w, "account not found", http.StatusNotFound)
+	case errors.Is(err, storage.ErrUnauthorised):
+		writeError(w, "only account moderators can do this", http.StatusForbidden)
+	default:
+		logrus.WithError(err).WithField("accountID", accountID).Errorln("Failed to review account")
+		writeError(w, "failed to review account", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Body of every error response of the api
+type ApiError struct {
+	// What went wrong. One of the REQUEST_ERROR_ or CODE_ERROR_ constants for problems with a body,
+	// otherwise the snake cased status text, like "not_found"
+	Error   string          `json:"error"`
+	Message string          `json:"message"`          // Human readable description of the problem
+	Field   string          `json:"field,omitempty"`  // The field with the problem, if it is about a single one
+	Line    *int            `json:"line,omitempty"`   // Line of a syntax problem in uploaded code, starting at 1
+	Column  *int            `json:"column,omitempty"` // Column of a syntax problem in uploaded code, starting at 1
+	Fields  []FieldMismatch `json:"fields,omitempty"` // The submitted fields that contradict the code's metadata
+}
+
+// Write an ApiError with the given status and message, using the status text as error code
+// Use instead of http.Error in api handlers
+func writeError(w http.ResponseWriter, message string, status int) {
+	writeApiError(w, status, &ApiError{Error: statusErrorCode(status), Message: message})
+}
+
+// Write an ApiError with the given status
+func writeApiError(w http.ResponseWriter, status int, apiErr *ApiError) {
+	jbody, err := json.Marshal(apiErr)
+	if err != nil {
+		logrus.WithError(err).Errorln("Failed to marshal api error")
+		http.Error(w, apiErr.Message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(jbody)
+}
+
+// The error code for a status without a more specific one, like "not_found" for 404
+func statusErrorCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/mstarongithub/mk-plugin-repo/auth"
+	"github.com/mstarongithub/mk-plugin-repo/storage"
+	"github.com/mstarongithub/mk-plugin-repo/util"
+)
+
+// Data expected for registering a new account via POST /api/v1/auth/register
+type RegisterData struct {
+	Name     string `json:"name"`     // Name of the new account
+	Mail     string `json:"mail"`     // Mail address of the new account. Optional
+	Password string `json:"password"` // Password for the new account
+}
+
+// Data expected for logging in via POST /api/v1/auth/login
+type LoginData struct {
+	Name     string `json:"name"`     // Name of the account
+	Password string `json:"password"` // Password of the account
+}
+
+// Data returned on a successful login
+type LoginResponse struct {
+	Token   string    `json:"token"`   // The session token. Send as "Authorization: Bearer <token>"
+	Expires time.Time `json:"expires"` // When the token expires
+}
+
+// Publicly visible data of an account
+type AccountInfo struct {
+	ID                uint   `json:"id"`                  // The unique ID of the account
+	Name              string `json:"name"`                // The name of the account
+	Description       string `json:"description"`         // The description the account owner added
+	Approved          bool   `json:"approved"`            // Whether the account is approved for publishing
+	CanApprovePlugins bool   `json:"can_approve_plugins"` // Whether the account is a plugin moderator
+	CanApproveUsers   bool   `json:"can_approve_users"`   // Whether the account can approve other accounts
+	// Review status of the account. Valid values are "pending", "approved" and "rejected"
+	ApprovalStatus string     `json:"approval_status"`
+	ReviewedByID   *uint      `json:"reviewed_by,omitempty"` // Who reviewed the account. Unset if not reviewed yet
+	ReviewedAt     *time.Time `json:"reviewed_at,omitempty"` // When the account was reviewed
+}
+
+// POST /api/v1/auth/register
+// Register a new account
+// Body must be a json-encoded RegisterData
+// Returns the AccountInfo of the new account. New accounts need approval before they can publish
+func register(w http.ResponseWriter, r *http.Request) {
+	authManager := AuthFromRequest(r)
+	if authManager == nil {
+		logrus.Errorln("register: Failed to get auth layer from request context")
+		writeError(w, "failed to get auth layer from request context", http.StatusInternalServerError)
+		return
+	}
+	data := RegisterData{}
+	if !decodeBody(w, r, &data, maxBodySize(false)) {
+		return
+	}
+
+	acc, err := authManager.Register(data.Name, data.Mail, data.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrMissingUsername), errors.Is(err, auth.ErrPasswordTooShort):
+			writeError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, storage.ErrAlreadyExists):
+			writeError(w, "an account with that name or mail already exists", http.StatusConflict)
+		default:
+			logrus.WithError(err).WithField("name", data.Name).Errorln("Failed to register account")
+			writeError(w, "failed to register account", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	jbody, err := json.Marshal(dbAccountToAccountInfo(acc))
+	if err != nil {
+		logrus.WithError(err).Errorln("register: Failed to marshal account info")
+		writeError(w, "json encoding failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jbody)
+}
+
+// POST /api/v1/auth/login
+// Log in with name and password
+// Body must be a json-encoded LoginData
+// Returns a LoginResponse and sets the session cookie on success, 401 on bad credentials
+func login(w http.ResponseWriter, r *http.Request) {
+	authManager := AuthFromRequest(r)
+	if authManager == nil {
+		logrus.Errorln("login: Failed to get auth layer from request context")
+		writeError(w, "failed to get auth layer from request context", http.StatusInternalServerError)
+		return
+	}
+	data := LoginData{}
+	if !decodeBody(w, r, &data, maxBodySize(false)) {
+		return
+	}
+
+	ok, token, err := authManager.Login(data.Name, data.Password)
+	if err != nil {
+		logrus.WithError(err).WithField("name", data.Name).Errorln("Login failed")
+		writeError(w, "login failed", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		writeError(w, "bad name or password", http.StatusUnauthorized)
+		return
+	}
+	expires, err := util.GetTokenExpiry(token)
+	if err != nil {
+		logrus.WithError(err).Errorln("login: Freshly created token has no expiry")
+		writeError(w, "login failed", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.SESSION_COOKIE_NAME,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Secure:   r.TLS != nil,
+	})
+	jbody, err := json.Marshal(&LoginResponse{Token: token, Expires: expires})
+	if err != nil {
+		logrus.WithError(err).Errorln("login: Failed to marshal response")
+		writeError(w, "json encoding failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jbody)
+}
+
+// POST /api/v1/auth/logout
+// RESTRICTED
+// Revoke the session token used for this request and clear the session cookie
+func logout(w http.ResponseWriter, r *http.Request) {
+	authManager := AuthFromRequest(r)
+	if authManager == nil {
+		logrus.Errorln("logout: Failed to get auth layer from request context")
+		writeError(w, "failed to get auth layer from request context", http.StatusInternalServerError)
+		return
+	}
+	token := auth.TokenFromRequest(r)
+	if token == "" {
+		if auth.AccessTokenFromRequest(r) != nil {
+			writeError(
+				w,
+				"access tokens can't be logged out, revoke them via /api/v1/tokens instead",
+				http.StatusBadRequest,
+			)
+			return
+		}
+		writeError(w, "not logged in", http.StatusUnauthorized)
+		return
+	}
+	authManager.Logout(token)
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.SESSION_COOKIE_NAME,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
+
+// GET /api/v1/auth/me
+// RESTRICTED
+// Get the AccountInfo of the account the request is authenticated as
+func getOwnAccount(w http.ResponseWriter, r *http.Request) {
+	acc := AccountFromRequest(r)
+	if acc == nil {
+		writeError(w, "not logged in", http.StatusUnauthorized)
+		return
+	}
+	jbody, err := json.Marshal(dbAccountToAccountInfo(acc))
+	if err != nil {
+		logrus.WithError(err).Errorln("getOwnAccount: Failed to marshal account info")
+		writeError(w, "json encoding failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jbody))
+}
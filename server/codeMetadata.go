@@ -0,0 +1,119 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/mstarongithub/mk-plugin-repo/aiscript"
+	"github.com/mstarongithub/mk-plugin-repo/config"
+	"github.com/mstarongithub/mk-plugin-repo/storage"
+)
+
+const (
+	CODE_ERROR_INVALID_METADATA  = "invalid_metadata"  // The metadata header of the code couldn't be parsed
+	CODE_ERROR_METADATA_MISMATCH = "metadata_mismatch" // The metadata contradicts the submitted data
+	CODE_ERROR_MISSING_FIELD     = "missing_field"     // A value is neither submitted nor declared in the code
+	CODE_ERROR_INVALID_VERSION   = "invalid_version"   // The version name isn't a semantic version
+	CODE_ERROR_INVALID_SIGNATURE = "invalid_signature" // The signature doesn't match the code with any key of the uploader
+	CODE_ERROR_SYNTAX            = "syntax_error"      // The code isn't valid AiScript for the targeted version
+)
+
+// A submitted value contradicting what the code declares
+type FieldMismatch struct {
+	Field     string `json:"field"`     // Name of the submitted field
+	Submitted string `json:"submitted"` // The submitted value
+	Declared  string `json:"declared"`  // The value declared in the code
+}
+
+// Parse the metadata of uploaded code and check it against the submitted version name and AiScript version
+// Empty submitted values are taken from the metadata instead. The version name has to be a semantic version
+// and the code has to be valid for the AiScript version unless the config skips the syntax check
+// Returns the metadata and the version names to use
+// Writes 422 with an ApiError to the response and returns ok=false if the code can't be accepted
+func checkCodeMetadata(
+	w http.ResponseWriter,
+	code, versionName, aiscriptVersion string,
+) (meta *aiscript.Metadata, finalVersionName, finalAiscriptVersion string, ok bool) {
+	meta, err := aiscript.ParseMetadata(code)
+	if err != nil {
+		codeErr := ApiError{
+			Error:   CODE_ERROR_INVALID_METADATA,
+			Message: err.Error(),
+		}
+		var syntaxErr *aiscript.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			codeErr.Message = syntaxErr.Message
+			codeErr.Line = &syntaxErr.Line
+			codeErr.Column = &syntaxErr.Column
+		} else if !errors.Is(err, aiscript.ErrBadMetadataField) {
+			logrus.WithError(err).Errorln("Unexpected error while parsing code metadata")
+		}
+		writeCodeError(w, &codeErr)
+		return nil, "", "", false
+	}
+
+	if versionName == "" {
+		versionName = meta.Version
+	}
+	if aiscriptVersion == "" {
+		aiscriptVersion = meta.AiScriptVersion
+	}
+	mismatches := []FieldMismatch{}
+	if meta.Version != "" && meta.Version != versionName {
+		mismatches = append(mismatches, FieldMismatch{
+			Field:     "version_name",
+			Submitted: versionName,
+			Declared:  meta.Version,
+		})
+	}
+	if meta.AiScriptVersion != "" && meta.AiScriptVersion != aiscriptVersion {
+		mismatches = append(mismatches, FieldMismatch{
+			Field:     "aiscript_version",
+			Submitted: aiscriptVersion,
+			Declared:  meta.AiScriptVersion,
+		})
+	}
+	if len(mismatches) > 0 {
+		writeCodeError(w, &ApiError{
+			Error:   CODE_ERROR_METADATA_MISMATCH,
+			Message: "submitted data contradicts the metadata declared in the code",
+			Fields:  mismatches,
+		})
+		return nil, "", "", false
+	}
+	if versionName == "" {
+		writeCodeError(w, &ApiError{
+			Error:   CODE_ERROR_MISSING_FIELD,
+			Message: "no version name submitted or declared in the code",
+		})
+		return nil, "", "", false
+	}
+	if err = storage.ValidateVersionName(versionName); err != nil {
+		writeCodeError(w, &ApiError{
+			Error:   CODE_ERROR_INVALID_VERSION,
+			Message: err.Error(),
+		})
+		return nil, "", "", false
+	}
+	if config.GlobalConfig == nil || !config.GlobalConfig.AiScript.SkipSyntaxCheck {
+		if err = aiscript.CheckSyntax(code, aiscriptVersion); err != nil {
+			codeErr := ApiError{Error: CODE_ERROR_SYNTAX, Message: err.Error()}
+			var syntaxErr *aiscript.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				codeErr.Message = syntaxErr.Message
+				codeErr.Line = &syntaxErr.Line
+				codeErr.Column = &syntaxErr.Column
+			}
+			writeCodeError(w, &codeErr)
+			return nil, "", "", false
+		}
+	}
+	return meta, versionName, aiscriptVersion, true
+}
+
+// Write an ApiError about uploaded code with status 422
+func writeCodeError(w http.ResponseWriter, codeErr *ApiError) {
+	writeApiError(w, http.StatusUnprocessableEntity, codeErr)
+}
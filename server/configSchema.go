@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/mstarongithub/mk-plugin-repo/aiscript"
+	"github.com/mstarongithub/mk-plugin-repo/storage"
+)
+
+// The settings a version declares in its config block, as a JSON-Schema-like document
+type ConfigSchema struct {
+	Type       string           `json:"type"`       // Always "object"
+	Properties ConfigProperties `json:"properties"` // The settings by key
+	Order      []string         `json:"x-order"`    // The keys in declaration order
+}
+
+// One setting of a ConfigSchema
+type ConfigProperty struct {
+	Key         string `json:"-"`
+	Type        string `json:"type,omitempty"`        // JSON Schema type. Not set if the Misskey type has no equivalent
+	Title       string `json:"title,omitempty"`       // The label of the setting
+	Description string `json:"description,omitempty"` // The description of the setting
+	Default     any    `json:"default,omitempty"`     // The default value. Not set if none is declared
+	MisskeyType string `json:"x-misskey-type"`        // The type as declared in the code
+}
+
+// Settings of a ConfigSchema, marshalled as json object in declaration order
+type ConfigProperties []ConfigProperty
+
+func (properties ConfigProperties) MarshalJSON() ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, property := range properties {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(property.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(property)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Nil if the version declares no settings
+func dbVersionToConfigSchema(version *storage.PluginVersion) *ConfigSchema {
+	if len(version.ConfigFields) == 0 {
+		return nil
+	}
+	schema := ConfigSchema{
+		Type:       "object",
+		Properties: make(ConfigProperties, 0, len(version.ConfigFields)),
+		Order:      make([]string, 0, len(version.ConfigFields)),
+	}
+	for _, field := range version.ConfigFields {
+		property := ConfigProperty{
+			Key:         field.Key,
+			Title:       field.Label,
+			Description: field.Description,
+			Default:     field.Default,
+			MisskeyType: field.Type,
+		}
+		// Misskey's basic types are named like their JSON Schema counterparts
+		switch field.Type {
+		case aiscript.CONFIG_TYPE_STRING, aiscript.CONFIG_TYPE_NUMBER, aiscript.CONFIG_TYPE_BOOLEAN:
+			property.Type = field.Type
+		}
+		schema.Properties = append(schema.Properties, property)
+		schema.Order = append(schema.Order, field.Key)
+	}
+	return &schema
+}
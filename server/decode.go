@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mstarongithub/mk-plugin-repo/config"
+)
+
+// Largest request body accepted if the config doesn't set one
+const DEFAULT_MAX_BODY_SIZE = 64 * 1024
+
+// Largest body accepted for requests uploading code if the config doesn't set one
+const DEFAULT_MAX_CODE_BODY_SIZE = 1024 * 1024
+
+const (
+	REQUEST_ERROR_BODY_TOO_LARGE = "body_too_large" // The body is larger than allowed. Sent with status 413
+	REQUEST_ERROR_INVALID_JSON   = "invalid_json"   // The body is empty or not valid json
+	REQUEST_ERROR_UNKNOWN_FIELD  = "unknown_field"  // The body has a field the endpoint doesn't know
+	REQUEST_ERROR_MISSING_FIELD  = "missing_field"  // A required field is missing or empty
+	REQUEST_ERROR_INVALID_FIELD  = "invalid_field"  // A field has the wrong type, is too long or has a value that isn't allowed
+)
+
+// Implemented by request bodies that check their fields after decoding
+type validatable interface {
+	// Returns nil if all fields are fine
+	validate() *ApiError
+}
+
+// How large a request body may be. Bodies uploading code get a separate, larger limit
+func maxBodySize(withCode bool) int64 {
+	var configured int64
+	if config.GlobalConfig != nil {
+		if withCode {
+			configured = config.GlobalConfig.Limits.MaxCodeBodySize
+		} else {
+			configured = config.GlobalConfig.Limits.MaxBodySize
+		}
+	}
+	switch {
+	case configured > 0:
+		return configured
+	case withCode:
+		return DEFAULT_MAX_CODE_BODY_SIZE
+	default:
+		return DEFAULT_MAX_BODY_SIZE
+	}
+}
+
+// Decode a json request body into the given pointer and validate it if it is validatable
+// The body may be at most maxSize bytes and must not have fields the target doesn't know
+// Writes an ApiError to the response and returns false if the body can't be accepted
+func decodeBody(w http.ResponseWriter, r *http.Request, into any, maxSize int64) bool {
+	return decodeBodyInto(w, r, into, maxSize, false)
+}
+
+// Like decodeBody, but an empty body is fine and leaves the target as is
+func decodeOptionalBody(w http.ResponseWriter, r *http.Request, into any, maxSize int64) bool {
+	return decodeBodyInto(w, r, into, maxSize, true)
+}
+
+func decodeBodyInto(w http.ResponseWriter, r *http.Request, into any, maxSize int64, optional bool) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSize))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(into)
+	if errors.Is(err, io.EOF) && optional {
+		return true
+	}
+	if err == nil {
+		// Anything after the value means the body isn't a single json value
+		if _, err = decoder.Token(); errors.Is(err, io.EOF) {
+			err = nil
+		} else if err == nil {
+			err = errors.New("body has more than one json value")
+		}
+	}
+	if err != nil {
+		writeRequestError(w, requestErrorFor(err))
+		return false
+	}
+	if toCheck, ok := into.(validatable); ok {
+		if requestErr := toCheck.validate(); requestErr != nil {
+			writeRequestError(w, requestErr)
+			return false
+		}
+	}
+	return true
+}
+
+// Turn an error from decoding a body into the ApiError to return
+func requestErrorFor(err error) *ApiError {
+	var tooLarge *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &tooLarge):
+		return &ApiError{
+			Error:   REQUEST_ERROR_BODY_TOO_LARGE,
+			Message: fmt.Sprintf("body must be at most %d bytes", tooLarge.Limit),
+		}
+	case errors.Is(err, io.EOF):
+		return &ApiError{Error: REQUEST_ERROR_INVALID_JSON, Message: "body must not be empty"}
+	case errors.As(err, &typeErr):
+		return &ApiError{
+			Error:   REQUEST_ERROR_INVALID_FIELD,
+			Message: fmt.Sprintf("%s must be of type %s", typeErr.Field, typeErr.Type),
+			Field:   typeErr.Field,
+		}
+	// encoding/json has no error type for unknown fields
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &ApiError{
+			Error:   REQUEST_ERROR_UNKNOWN_FIELD,
+			Message: fmt.Sprintf("unknown field %q", field),
+			Field:   field,
+		}
+	default:
+		return &ApiError{Error: REQUEST_ERROR_INVALID_JSON, Message: "body must be valid json: " + err.Error()}
+	}
+}
+
+// Write an ApiError about a request body. Status 413 if the body is too large, 400 otherwise
+func writeRequestError(w http.ResponseWriter, requestErr *ApiError) {
+	status := http.StatusBadRequest
+	if requestErr.Error == REQUEST_ERROR_BODY_TOO_LARGE {
+		status = http.StatusRequestEntityTooLarge
+	}
+	writeApiError(w, status, requestErr)
+}
+
+// An ApiError for a required field that is missing or empty
+func missingField(field string) *ApiError {
+	return &ApiError{
+		Error:   REQUEST_ERROR_MISSING_FIELD,
+		Message: field + " must not be empty",
+		Field:   field,
+	}
+}
+
+// An ApiError for a field with a value that isn't allowed
+func invalidField(field, format string, args ...any) *ApiError {
+	return &ApiError{
+		Error:   REQUEST_ERROR_INVALID_FIELD,
+		Message: field + " " + fmt.Sprintf(format, args...),
+		Field:   field,
+	}
+}
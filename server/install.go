@@ -0,0 +1,196 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/mstarongithub/mk-plugin-repo/misskey"
+	"github.com/mstarongithub/mk-plugin-repo/storage"
+	customtypes "github.com/mstarongithub/mk-plugin-repo/storage/customTypes"
+)
+
+// How long the software of an instance is trusted before it is fetched again
+const INSTANCE_RECHECK_INTERVAL = 24 * time.Hour
+
+// Returned from GET /api/v1/plugins/{pluginId}/{versionName}/install
+type InstallInfo struct {
+	Host            string `json:"host"`             // The normalised host of the instance
+	Software        string `json:"software"`         // Software the instance runs, like "misskey"
+	SoftwareVersion string `json:"software_version"` // Version of that software
+	VersionName     string `json:"version_name"`     // The plugin version that gets installed
+	// How the plugin gets installed. One of "install-extensions", "paste" and "widget"
+	Method     string `json:"method"`
+	InstallUrl string `json:"install_url,omitempty"` // Page on the instance to open. Not set for widgets
+	// Where the code of the version can be fetched. For "install-extensions" the install payload containing it
+	CodeUrl string `json:"code_url"`
+	SHA256  string `json:"sha256"` // Hex encoded SHA-256 hash of the code
+}
+
+// GET /api/v1/plugins/{pluginId}/{versionName}/install?host={host}
+// GET /api/v1/plugins/{pluginId}/latest/install?host={host}
+// Get how to install a version on a Misskey instance, given by the GET parameter "host"
+// Optional GET parameter "channel" picks the current version of that channel for latest
+// Optional GET parameter "redirect=true" redirects to the install page right away.
+// Widgets can't be installed via link, they are redirected to the code instead
+// Returns a json formatted InstallInfo. 400 if the host isn't valid, 410 if the version is yanked
+// and the caller doesn't manage the plugin,
+// 422 if the instance doesn't run Misskey or a fork and 502 if its software can't be found out
+func getInstallLink(w http.ResponseWriter, r *http.Request) {
+	store, plugin, version, ok := versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+	// Yanked versions stay fetchable for existing installs, but mustn't be installed anew
+	if version.Yanked && !plugin.CanBeManagedBy(AccountFromRequest(r)) {
+		message := "version is yanked"
+		if version.YankReason != "" {
+			message += ": " + version.YankReason
+		}
+		writeError(w, message, http.StatusGone)
+		return
+	}
+	query := r.URL.Query()
+	host, err := misskey.NormaliseHost(query.Get("host"))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	instance, ok := instanceFromHost(w, r, store, host)
+	if !ok {
+		return
+	}
+	software := &misskey.Software{Name: instance.Software, Version: instance.SoftwareVersion}
+	if !misskey.IsMisskeyFamily(software) {
+		writeError(
+			w,
+			fmt.Sprintf("%s runs %s, which doesn't support AiScript plugins", host, instance.Software),
+			http.StatusUnprocessableEntity,
+		)
+		return
+	}
+
+	payload, err := misskey.InstallPayload(version.Code)
+	if err != nil {
+		logrus.WithError(err).WithField("pluginId", plugin.ID).Errorln("Failed to build install payload")
+		writeError(w, "failed to build install payload", http.StatusInternalServerError)
+		return
+	}
+	payloadUrl := versionUrl(version, "install.json5")
+	method, installUrl := misskey.InstallLink(
+		host,
+		software,
+		plugin.Type == customtypes.PLUGIN_TYPE_WIDGET,
+		payloadUrl,
+		misskey.PayloadHash(payload),
+	)
+	codeUrl := versionUrl(version, "raw")
+	if method == misskey.INSTALL_METHOD_EXTENSIONS {
+		codeUrl = payloadUrl
+	}
+	if err = store.RecordPluginInstall(version, instance, method); err != nil {
+		logrus.WithError(err).WithField("pluginId", plugin.ID).Warnln("Failed to record install")
+	}
+
+	if query.Get("redirect") == "true" {
+		if installUrl == "" {
+			http.Redirect(w, r, codeUrl, http.StatusFound)
+		} else {
+			http.Redirect(w, r, installUrl, http.StatusFound)
+		}
+		return
+	}
+	jbody, err := json.Marshal(&InstallInfo{
+		Host:            host,
+		Software:        instance.Software,
+		SoftwareVersion: instance.SoftwareVersion,
+		VersionName:     version.Version,
+		Method:          method,
+		InstallUrl:      installUrl,
+		CodeUrl:         codeUrl,
+		SHA256:          version.CodeSHA256,
+	})
+	if err != nil {
+		logrus.WithError(err).Errorln("getInstallLink: Failed to marshal install info")
+		writeError(w, "json encoding failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jbody)
+}
+
+// GET /api/v1/plugins/{pluginId}/{versionName}/install.json5
+// Get the payload the /install-extensions page of a Misskey instance fetches to install the version
+// Returns the JSON5 payload. Its hex encoded SHA-512 hash is sent as ETag and in the install link
+// Fetching it counts as download, like fetching the raw code
+func getInstallPayload(w http.ResponseWriter, r *http.Request) {
+	store, _, version, ok := versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+	payload, err := misskey.InstallPayload(version.Code)
+	if err != nil {
+		logrus.WithError(err).WithField("pluginId", version.PluginID).Errorln("Failed to build install payload")
+		writeError(w, "failed to build install payload", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json5; charset=utf-8")
+	w.Header().Set("ETag", `"`+misskey.PayloadHash(payload)+`"`)
+	setYankHeaders(w, version)
+	serveDownload(w, r, store, version, version.CreatedAt, bytes.NewReader(payload))
+}
+
+// Public url of a file of the version, like its "raw" code
+func versionUrl(version *storage.PluginVersion, file string) string {
+	return publicUrl(fmt.Sprintf(
+		"/api/v1/plugins/%d/%s/%s",
+		version.PluginID,
+		url.PathEscape(version.Version),
+		file,
+	))
+}
+
+// Get the instance with the given host and the software it runs
+// The software is fetched again via nodeinfo if it wasn't checked recently.
+// If that fails, what is known already is used
+// Writes 502 to the response and returns ok=false if the software isn't known and can't be fetched
+func instanceFromHost(
+	w http.ResponseWriter,
+	r *http.Request,
+	store *storage.Storage,
+	host string,
+) (*storage.Instance, bool) {
+	instance, err := store.GetInstance(host)
+	if err != nil && !errors.Is(err, storage.ErrInstanceNotFound) {
+		logrus.WithError(err).WithField("host", host).Errorln("Failed to get instance")
+		writeError(w, "failed to get instance", http.StatusInternalServerError)
+		return nil, false
+	}
+	if instance != nil && instance.CheckedAt != nil &&
+		time.Since(*instance.CheckedAt) < INSTANCE_RECHECK_INTERVAL {
+		return instance, true
+	}
+
+	software, err := misskey.FetchSoftware(r.Context(), host)
+	if err != nil {
+		logrus.WithError(err).WithField("host", host).Infoln("Failed to fetch software of instance")
+		if instance != nil && instance.Software != "" {
+			return instance, true
+		}
+		writeError(w, "couldn't find out which software the instance runs", http.StatusBadGateway)
+		return nil, false
+	}
+	instance, err = store.RecordInstance(host, software.Name, software.Version)
+	if err != nil {
+		logrus.WithError(err).WithField("host", host).Errorln("Failed to record instance")
+		writeError(w, "failed to record instance", http.StatusInternalServerError)
+		return nil, false
+	}
+	return instance, true
+}
@@ -2,11 +2,14 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
 	"github.com/justinas/nosurf"
 	"github.com/sirupsen/logrus"
 	"gitlab.com/mstarongitlab/weblogger"
+
+	"github.com/mstarongithub/mk-plugin-repo/auth"
 )
 
 type HandlerBuilder func(http.Handler) http.Handler
@@ -59,3 +62,76 @@ func NosurfTokenInsertMiddleware(h http.Handler) http.Handler {
 		h.ServeHTTP(w, newReq)
 	})
 }
+
+// Reject all requests that aren't authenticated with 401
+func RequireAuthentication(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if AccountFromRequest(r) == nil {
+			logrus.WithFields(logrus.Fields{
+				"method": r.Method,
+				"path":   r.URL.Path,
+			}).Debugln("Unauthenticated request to restricted endpoint")
+			writeError(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Reject all requests authenticated with an access token lacking the given scope with 403
+// Expects to run after RequireAuthentication
+func RequireScope(scope string) HandlerBuilder {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !auth.RequestHasScope(r, scope) {
+				logrus.WithFields(logrus.Fields{
+					"method": r.Method,
+					"path":   r.URL.Path,
+					"scope":  scope,
+				}).Debugln("Access token lacks required scope")
+				writeError(
+					w,
+					fmt.Sprintf("access token is missing the %q scope", scope),
+					http.StatusForbidden,
+				)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Reject all requests authenticated with an access token instead of a session with 403
+func RequireSession(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.AccessTokenFromRequest(r) != nil {
+			writeError(w, "this endpoint can't be used with access tokens", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Reject all requests from accounts that aren't plugin moderators with 403
+// Expects to run after RequireAuthentication
+func RequirePluginModerator(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if acc := AccountFromRequest(r); acc == nil || !acc.CanApprovePlugins {
+			writeError(w, "only plugin moderators can do this", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Reject all requests from accounts that can't approve other accounts with 403
+// Expects to run after RequireAuthentication
+func RequireUserModerator(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if acc := AccountFromRequest(r); acc == nil || !acc.CanApproveUsers {
+			writeError(w, "only account moderators can do this", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -5,206 +5,558 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/sirupsen/logrus"
+	"gitlab.com/mstarongitlab/goutils/sliceutils"
 
+	"github.com/mstarongithub/mk-plugin-repo/aiscript"
 	"github.com/mstarongithub/mk-plugin-repo/storage"
 )
 
 type VersionData struct {
 	Code                    string `json:"code"`
 	IntendedAiScriptVersion string `json:"aiscript_version"`
+	// Whether the targeted AiScript version is known and current. One of "compatible", "legacy" and "unknown"
+	AiScriptCompatibility string    `json:"aiscript_compatibility"`
+	SHA256                string    `json:"sha256"`      // Hex encoded SHA-256 hash of the code
+	Integrity             string    `json:"integrity"`   // Subresource integrity string of the code, like "sha256-<base64>"
+	Permissions           []string  `json:"permissions"` // Misskey permissions the code requests
+	RiskLevel             string    `json:"risk_level"`  // How risky the requested permissions are
+	Channel               string    `json:"channel"`     // Release channel of the version
+	Changelog             string    `json:"changelog"`   // Markdown formatted notes on what changed
+	CreatedAt             time.Time `json:"created_at"`  // When the version was uploaded
+	// The settings the code declares in its config block. Null if it declares none
+	ConfigSchema *ConfigSchema `json:"config_schema"`
+	YankInfo
+	PermissionChanges
+	SignatureInfo
+}
+
+// Who signed the code of a version. Empty if the version isn't signed
+type SignatureInfo struct {
+	SignedBy       *uint  `json:"signed_by,omitempty"`       // ID of the account whose key signed the code
+	KeyFingerprint string `json:"key_fingerprint,omitempty"` // Fingerprint of the key, see GET /api/v1/accounts/{id}/keys
+	Signature      []byte `json:"signature,omitempty"`       // The detached ed25519 signature of the code, base64 encoded
+}
+
+// Whether and why a version was yanked
+type YankInfo struct {
+	Yanked     bool       `json:"yanked"`                // Yanked versions are no longer listed and never current
+	YankReason string     `json:"yank_reason,omitempty"` // Why the version was yanked
+	YankedAt   *time.Time `json:"yanked_at,omitempty"`   // When the version was yanked
+}
+
+// Optionally sent when yanking a version
+type Yank struct {
+	Reason string `json:"reason"` // Why the version is yanked. Shown to users fetching it
+}
+
+// One entry of the release history returned from GET /api/v1/plugins/{pluginId}/versions
+type VersionInfo struct {
+	VersionName     string `json:"version_name"`     // Name of the version
+	AiScriptVersion string `json:"aiscript_version"` // The AiScript version the version targets
+	// Whether the targeted AiScript version is known and current. One of "compatible", "legacy" and "unknown"
+	AiScriptCompatibility string    `json:"aiscript_compatibility"`
+	Channel               string    `json:"channel"`         // Release channel of the version
+	RiskLevel             string    `json:"risk_level"`      // How risky the requested permissions are
+	Changelog             string    `json:"changelog"`       // Markdown formatted notes on what changed
+	CreatedAt             time.Time `json:"created_at"`      // When the version was uploaded
+	HeldForReview         bool      `json:"held_for_review"` // Whether the version waits for a moderator
+	YankInfo
+}
+
+// How the permissions of a version differ from the version that was current when it was uploaded
+type PermissionChanges struct {
+	AddedPermissions   []string `json:"added_permissions"`   // Permissions the previous version didn't request
+	RemovedPermissions []string `json:"removed_permissions"` // Permissions the previous version requested, but this one doesn't
+	// Whether the version waits for a moderator because it requests more permissions. It isn't current until approved
+	HeldForReview bool `json:"held_for_review"`
+}
+
+// Data returned after creating a new version via POST /api/v1/plugins/{pluginId}
+type NewVersionResponse struct {
+	VersionName     string `json:"version_name"`     // Name of the new version
+	AiScriptVersion string `json:"aiscript_version"` // The AiScript version the new version targets
+	PermissionChanges
 }
 
 type NewVersion struct {
 	Code                    string `json:"code"`
 	IntendedAiScriptVersion string `json:"aiscript_version"`
 	VersionName             string `json:"version_name"`
+	Changelog               string `json:"changelog"`
+	Signature               []byte `json:"signature"`       // Optional detached ed25519 signature of the code, base64 encoded
+	KeyFingerprint          string `json:"key_fingerprint"` // Optional fingerprint of the key that made the signature
+}
+
+// Longest changelog accepted for a new version, in characters
+const MAX_CHANGELOG_LENGTH = 20000
+
+func (version *NewVersion) validate() *ApiError {
+	if strings.TrimSpace(version.Code) == "" {
+		return missingField("code")
+	}
+	if utf8.RuneCountInString(version.Changelog) > MAX_CHANGELOG_LENGTH {
+		return invalidField("changelog", "must be at most %d characters long", MAX_CHANGELOG_LENGTH)
+	}
+	return nil
 }
 
 // GET /api/v1/plugins/{pluginId}/{versionName}
 // Get the details for a specific version
 // Returns a json formatted VersionData on success
 func getVersion(w http.ResponseWriter, r *http.Request) {
-	store := StorageFromRequest(r)
+	_, _, version, ok := versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+	binaryData, err := json.Marshal(&VersionData{
+		Code:                    version.Code,
+		IntendedAiScriptVersion: version.AiScriptVersion,
+		AiScriptCompatibility:   string(aiscript.Classify(version.AiScriptVersion)),
+		SHA256:                  version.CodeSHA256,
+		Integrity:               version.Integrity(),
+		Permissions:             version.Permissions,
+		RiskLevel:               version.RiskLevel,
+		Channel:                 string(version.Channel),
+		Changelog:               version.Changelog,
+		CreatedAt:               version.CreatedAt,
+		ConfigSchema:            dbVersionToConfigSchema(version),
+		YankInfo:                dbVersionToYankInfo(version),
+		PermissionChanges:       dbVersionToPermissionChanges(version),
+		SignatureInfo:           dbVersionToSignatureInfo(version),
+	})
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"pluginId":    version.PluginID,
+			"versionName": version.Version,
+			"version":     version,
+		}).Errorln("Failed to marshal version")
+		writeError(w, "json marshalling failed", http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(w, string(binaryData))
+}
+
+// GET /api/v1/plugins/{pluginId}/{versionName}/raw
+// GET /api/v1/plugins/{pluginId}/latest/raw
+// Get the code of a specific or the current version as plain text, named after the plugin
+// Optional GET parameter "channel" picks the current version of that channel for latest
+// The ETag is the SHA-256 hash of the code and the Digest header carries it too.
+// Conditional requests get 304 if the code didn't change
+// Yanked versions are marked with "X-Yanked: true" and the reason in X-Yank-Reason
+func getVersionRaw(w http.ResponseWriter, r *http.Request) {
+	store, plugin, version, ok := versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+	lastModified := version.CreatedAt
+	if r.PathValue("versionName") == "" {
+		// Which version is the latest can change at any time, even to an older one.
+		// The plugin is updated whenever it does
+		if plugin.UpdatedAt.After(lastModified) {
+			lastModified = plugin.UpdatedAt
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(
+		"inline",
+		map[string]string{"filename": rawCodeFilename(plugin, version)},
+	))
+	w.Header().Set("ETag", `"`+version.CodeSHA256+`"`)
+	w.Header().Set("Digest", "SHA-256="+strings.TrimPrefix(version.Integrity(), "sha256-"))
+	setYankHeaders(w, version)
+	serveDownload(w, r, store, version, lastModified, strings.NewReader(version.Code))
+}
+
+// Serve the code of a version, or a file containing it, and count it as download of the plugin
+func serveDownload(
+	w http.ResponseWriter,
+	r *http.Request,
+	store *storage.Storage,
+	version *storage.PluginVersion,
+	lastModified time.Time,
+	content io.ReadSeeker,
+) {
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	http.ServeContent(recorder, r, "", lastModified, content)
+	// Revalidating a cached copy isn't a download
+	if r.Method == http.MethodGet && recorder.status == http.StatusOK {
+		if err := store.CountPluginDownload(version.PluginID); err != nil {
+			logrus.WithError(err).WithField("pluginId", version.PluginID).Warnln("Failed to count download")
+		}
+	}
+}
+
+// Mark a response with the code of a yanked version as such
+func setYankHeaders(w http.ResponseWriter, version *storage.PluginVersion) {
+	if !version.Yanked {
+		return
+	}
+	w.Header().Set("X-Yanked", "true")
+	if version.YankReason != "" {
+		// Header values can't carry line breaks or non-ASCII characters as they are
+		w.Header().Set("X-Yank-Reason", mime.QEncoding.Encode("utf-8", version.YankReason))
+	}
+}
+
+// Get the plugin and version named in the path of a request, if the requesting account may see them
+// Versions held for review are only visible to the plugin's maintainers and moderators
+// Routes without a version name in the path get the current version instead,
+// of the channel given by the optional GET parameter "channel"
+// Writes an error to the response and returns ok=false otherwise
+func versionFromRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+) (store *storage.Storage, plugin *storage.Plugin, version *storage.PluginVersion, ok bool) {
+	store = StorageFromRequest(r)
 	if store == nil {
-		logrus.Errorln("getVersion: Failed to get storage from request context")
-		http.Error(
+		logrus.Errorln("Failed to get storage from request context")
+		writeError(
 			w,
 			"failed to get storage layer from request context",
 			http.StatusInternalServerError,
 		)
-		return
+		return nil, nil, nil, false
 	}
 	pluginIDString := r.PathValue("pluginId")
 	versionName := r.PathValue("versionName")
-	if pluginIDString == "" || versionName == "" {
+	if pluginIDString == "" {
 		logrus.WithFields(logrus.Fields{
 			"pluginId":    pluginIDString,
 			"versionName": versionName,
 		}).Infoln("Bad path request parameters")
-		http.Error(w, "bad path parameters", http.StatusBadRequest)
-		return
+		writeError(w, "bad path parameters", http.StatusBadRequest)
+		return nil, nil, nil, false
 	}
 	pluginID, err := strconv.ParseUint(pluginIDString, 10, 0)
 	if err != nil {
 		logrus.WithError(err).WithFields(logrus.Fields{
 			"pluginId":    pluginIDString,
 			"versionName": versionName,
-		}).Infoln("Plugin ID is parsable as uint")
+		}).Infoln("Plugin ID is not parsable as uint")
+		writeError(w, "bad plugin id. Must be a uint", http.StatusBadRequest)
+		return nil, nil, nil, false
+	}
+	plugin, err = store.GetPluginByID(uint(pluginID))
+	if err != nil || !plugin.VisibleTo(AccountFromRequest(r)) {
+		if err != nil && !errors.Is(err, storage.ErrPluginNotFound) {
+			logrus.WithError(err).WithField("pluginId", pluginID).Errorln("Problem getting plugin")
+			writeError(w, "error getting plugin from storage layer", http.StatusInternalServerError)
+		} else {
+			writeError(w, "plugin not found", http.StatusNotFound)
+		}
+		return nil, nil, nil, false
+	}
+	if versionName == "" {
+		channel, ok := channelFromQuery(w, r.URL.Query())
+		if !ok {
+			return nil, nil, nil, false
+		}
+		if channel != nil {
+			versionName = plugin.CurrentVersions[*channel]
+		} else {
+			versionName = plugin.CurrentVersion
+		}
+		if versionName == "" {
+			writeError(w, "plugin has no current version", http.StatusNotFound)
+			return nil, nil, nil, false
+		}
+	}
+	version, err = store.TryFindVersion(uint(pluginID), versionName)
+	// Versions held for review don't exist for anyone but the plugin's maintainers and moderators
+	if err == nil && version.HeldForReview && !plugin.CanBeManagedBy(AccountFromRequest(r)) {
+		err = storage.ErrVersionNotFound
 	}
-	version, err := store.TryFindVersion(uint(pluginID), versionName)
 	if err != nil {
 		if errors.Is(err, storage.ErrVersionNotFound) {
 			logrus.WithFields(logrus.Fields{
 				"pluginId":    pluginID,
 				"versionName": versionName,
 			}).Infoln("Plugin version not found")
+			writeError(w, "version not found", http.StatusNotFound)
 		} else {
 			logrus.WithError(err).WithFields(logrus.Fields{
 				"pluginId":    pluginID,
 				"versionName": versionName,
 			}).Error("Problem getting version for plugin")
+			writeError(w, "error getting version from storage layer", http.StatusInternalServerError)
 		}
+		return nil, nil, nil, false
 	}
 	logrus.WithFields(logrus.Fields{
 		"pluginId":    pluginID,
 		"versionName": versionName,
 		"version":     version,
 	}).Debugln("Found plugin version")
-	binaryData, err := json.Marshal(&VersionData{
-		Code:                    version.Code,
-		IntendedAiScriptVersion: version.AiScriptVersion,
+	return store, plugin, version, true
+}
+
+// GET /api/v1/plugins/{pluginId}/versions
+// Get the release history of a plugin, newest first
+// Versions held for review and yanked ones are only included for the plugin's maintainers and moderators
+// Returns a json formatted array of VersionInfo
+func getVersionHistory(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("getVersionHistory: Failed to get storage from request context")
+		writeError(
+			w,
+			"failed to get storage layer from request context",
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	pluginID, err := strconv.ParseUint(r.PathValue("pluginId"), 10, 0)
+	if err != nil {
+		writeError(w, "bad plugin id. Must be a uint", http.StatusBadRequest)
+		return
+	}
+	acc := AccountFromRequest(r)
+	plugin, err := store.GetPluginByID(uint(pluginID))
+	if err != nil || !plugin.VisibleTo(acc) {
+		if err != nil && !errors.Is(err, storage.ErrPluginNotFound) {
+			logrus.WithError(err).WithField("pluginId", pluginID).Errorln("Problem getting plugin")
+			writeError(w, "error getting plugin from storage layer", http.StatusInternalServerError)
+		} else {
+			writeError(w, "plugin not found", http.StatusNotFound)
+		}
+		return
+	}
+	canManage := plugin.CanBeManagedBy(acc)
+	versions := sliceutils.Filter(store.GetVersionsFor(plugin.ID), func(version storage.PluginVersion) bool {
+		return canManage || (!version.HeldForReview && !version.Yanked)
 	})
+	history := sliceutils.Map(versions, func(version storage.PluginVersion) VersionInfo {
+		return VersionInfo{
+			VersionName:           version.Version,
+			AiScriptVersion:       version.AiScriptVersion,
+			AiScriptCompatibility: string(aiscript.Classify(version.AiScriptVersion)),
+			Channel:               string(version.Channel),
+			RiskLevel:             version.RiskLevel,
+			Changelog:             version.Changelog,
+			CreatedAt:             version.CreatedAt,
+			HeldForReview:         version.HeldForReview,
+			YankInfo:              dbVersionToYankInfo(&version),
+		}
+	})
+	jbody, err := json.Marshal(history)
 	if err != nil {
-		logrus.WithError(err).WithFields(logrus.Fields{
-			"pluginId":    pluginID,
-			"versionName": versionName,
-			"version":     version,
-		}).Errorln("Failed to marshal version")
-		http.Error(w, "json marshalling failed", http.StatusInternalServerError)
+		logrus.WithError(err).WithField("pluginId", pluginID).Errorln("Failed to marshal version history")
+		writeError(w, "json marshalling failed", http.StatusInternalServerError)
 		return
 	}
-	fmt.Fprint(w, string(binaryData))
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jbody)
 }
 
 // POST /api/v1/plugins/{pluginId}
 // RESTRICTED
 // Create a new version
 // Expects json formatted NewVersion
+// Returns 400 or 413 with an ApiError if the body is invalid
+// Returns 422 with an ApiError if the code has a syntax error or its metadata is malformed or contradicts the submitted data
+// Returns a NewVersionResponse with 201, or 202 if the version requests more permissions and is held for review
 // Returns 4xx (whatever the bad request status is) if the version already exists
 func newVersion(w http.ResponseWriter, r *http.Request) {
 	store := StorageFromRequest(r)
 	if store == nil {
 		logrus.Errorln("newVersion: Failed to get storage from request context")
-		http.Error(
+		writeError(
 			w,
 			"failed to get storage layer from request context",
 			http.StatusInternalServerError,
 		)
 		return
 	}
-	// ab := AuthbossFromRequest(r)
-	// if ab == nil {
-	// 	logrus.Errorln("newVersion: Failed to get authboss instance from request context")
-	// 	http.Error(
-	// 		w,
-	// 		"failed to get auth layer from request context",
-	// 		http.StatusInternalServerError,
-	// 	)
-	// 	return
-	// }
 	pluginIDString := r.PathValue("pluginId")
 	if pluginIDString == "" {
 		logrus.WithFields(logrus.Fields{
 			"pluginId": pluginIDString,
 		}).Infoln("Bad path request parameters")
-		http.Error(w, "bad path parameters", http.StatusBadRequest)
+		writeError(w, "bad path parameters", http.StatusBadRequest)
 		return
 	}
 	pluginID, err := strconv.ParseUint(pluginIDString, 10, 0)
 	if err != nil {
 		logrus.WithError(err).WithFields(logrus.Fields{
 			"pluginId": pluginIDString,
-		}).Infoln("Plugin ID is parsable as uint")
+		}).Infoln("Plugin ID is not parsable as uint")
+		writeError(w, "bad plugin id. Must be a uint", http.StatusBadRequest)
+		return
+	}
+	if !checkPluginManagementRights(w, r, store, uint(pluginID)) {
+		return
 	}
 
-	// Ignore error. Should never fail I think
-	body, _ := io.ReadAll(r.Body)
 	newVersion := NewVersion{}
-	err = json.Unmarshal(body, &newVersion)
-	if err != nil {
-		logrus.WithError(err).WithFields(logrus.Fields{
-			"body":           body,
-			"body-as-string": string(body),
-			"pluginId":       pluginID,
-		}).Debugln("Failed to extract new version from body")
-		http.Error(w, "body is not a json-encoded NewVersion", http.StatusBadRequest)
+	if !decodeBody(w, r, &newVersion, maxBodySize(true)) {
+		return
 	}
 
-	err = store.NewVersion(
-		uint(pluginID),
-		newVersion.VersionName,
+	meta, versionName, aiscriptVersion, ok := checkCodeMetadata(
+		w,
 		newVersion.Code,
+		newVersion.VersionName,
 		newVersion.IntendedAiScriptVersion,
 	)
+	if !ok {
+		return
+	}
+	acc := AccountFromRequest(r)
+	signature, ok := checkCodeSignature(
+		w,
+		store,
+		acc,
+		newVersion.Code,
+		newVersion.Signature,
+		newVersion.KeyFingerprint,
+	)
+	if !ok {
+		return
+	}
+
+	version, err := store.NewVersion(
+		uint(pluginID),
+		acc.ID,
+		versionName,
+		newVersion.Code,
+		aiscriptVersion,
+		newVersion.Changelog,
+		meta,
+		signature,
+	)
 	if err != nil {
-		if !errors.Is(err, storage.ErrVersionAlreadyExists) {
+		if !errors.Is(err, storage.ErrVersionAlreadyExists) && !errors.Is(err, storage.ErrAlreadyExists) {
 			logrus.WithError(err).WithFields(logrus.Fields{
 				"new-version": newVersion,
 				"pluginId":    pluginID,
 			}).Errorln("failed to create new version")
-			http.Error(w, "version creation failed", http.StatusInternalServerError)
+			writeError(w, "version creation failed", http.StatusInternalServerError)
 		} else {
 			logrus.WithFields(logrus.Fields{
 				"new-version": newVersion,
 				"pluginId":    pluginID,
 			}).Debugln("version with that name already exists, ignoring")
-			http.Error(w, "version already exists", http.StatusNotAcceptable)
+			writeError(w, "version already exists", http.StatusNotAcceptable)
 		}
 		return
 	}
+	jbody, err := json.Marshal(&NewVersionResponse{
+		VersionName:       version.Version,
+		AiScriptVersion:   version.AiScriptVersion,
+		PermissionChanges: dbVersionToPermissionChanges(version),
+	})
+	if err != nil {
+		logrus.WithError(err).Errorln("newVersion: Failed to marshal response")
+		writeError(w, "json encoding failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if version.HeldForReview {
+		w.WriteHeader(http.StatusAccepted)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+	w.Write(jbody)
 }
 
 // DELETE /api/v1/plugins/{pluginId}/{versionName}
+// POST /api/v1/plugins/{pluginId}/{versionName}/yank
 // RESTRICTED
-// Hide a version. Doesn't delete, just hides it from the API
-func hideVersion(w http.ResponseWriter, r *http.Request) {
-	store := StorageFromRequest(r)
+// Yank a version. It stays fetchable, but is no longer listed and never current
+// Optionally expects a json formatted Yank with the reason
+// Returns 409 if the version is held for review
+func yankVersion(w http.ResponseWriter, r *http.Request) {
+	store, pluginID, versionName, ok := versionManagementParams(w, r)
+	if !ok {
+		return
+	}
+	yank := Yank{}
+	if !decodeOptionalBody(w, r, &yank, maxBodySize(false)) {
+		return
+	}
+	err := store.YankVersion(pluginID, versionName, AccountFromRequest(r), yank.Reason)
+	if err != nil {
+		writeYankError(w, err, pluginID, versionName)
+	}
+}
+
+// POST /api/v1/plugins/{pluginId}/{versionName}/unyank
+// RESTRICTED
+// Undo yanking a version. It becomes current again if it is the highest version of its channel
+func unyankVersion(w http.ResponseWriter, r *http.Request) {
+	store, pluginID, versionName, ok := versionManagementParams(w, r)
+	if !ok {
+		return
+	}
+	if err := store.UnyankVersion(pluginID, versionName, AccountFromRequest(r)); err != nil {
+		writeYankError(w, err, pluginID, versionName)
+	}
+}
+
+// Get the storage and the plugin ID and version name from the path of a request managing a version
+// Writes an error to the response and returns ok=false if any is missing
+// or the account isn't allowed to manage the plugin
+func versionManagementParams(
+	w http.ResponseWriter,
+	r *http.Request,
+) (store *storage.Storage, pluginID uint, versionName string, ok bool) {
+	store = StorageFromRequest(r)
 	if store == nil {
-		logrus.Errorln("getVersion: Failed to get storage from request context")
-		http.Error(
+		logrus.Errorln("Failed to get storage from request context")
+		writeError(
 			w,
 			"failed to get storage layer from request context",
 			http.StatusInternalServerError,
 		)
-		return
+		return nil, 0, "", false
 	}
 	pluginIDString := r.PathValue("pluginId")
-	versionName := r.PathValue("versionName")
+	versionName = r.PathValue("versionName")
 	if pluginIDString == "" || versionName == "" {
 		logrus.WithFields(logrus.Fields{
 			"pluginId":    pluginIDString,
 			"versionName": versionName,
 		}).Infoln("Bad path request parameters")
-		http.Error(w, "bad path parameters", http.StatusBadRequest)
-		return
+		writeError(w, "bad path parameters", http.StatusBadRequest)
+		return nil, 0, "", false
 	}
-	pluginID, err := strconv.ParseUint(pluginIDString, 10, 0)
+	id, err := strconv.ParseUint(pluginIDString, 10, 0)
 	if err != nil {
 		logrus.WithError(err).WithFields(logrus.Fields{
 			"pluginId":    pluginIDString,
 			"versionName": versionName,
-		}).Infoln("Plugin ID is parsable as uint")
+		}).Infoln("Plugin ID is not parsable as uint")
+		writeError(w, "bad plugin id. Must be a uint", http.StatusBadRequest)
+		return nil, 0, "", false
 	}
-	if err = store.HideVersion(uint(pluginID), versionName); err != nil {
+	if !checkPluginManagementRights(w, r, store, uint(id)) {
+		return nil, 0, "", false
+	}
+	return store, uint(id), versionName, true
+}
+
+func writeYankError(w http.ResponseWriter, err error, pluginID uint, versionName string) {
+	switch {
+	case errors.Is(err, storage.ErrVersionNotFound):
+		writeError(w, "version not found", http.StatusNotFound)
+	case errors.Is(err, storage.ErrVersionHeldForReview):
+		writeError(w, "version is held for review", http.StatusConflict)
+	case errors.Is(err, storage.ErrUnauthorised):
+		writeError(w, "you're not a maintainer of the plugin", http.StatusForbidden)
+	default:
 		logrus.WithError(err).WithFields(logrus.Fields{
 			"pluginID":    pluginID,
 			"versionName": versionName,
-		}).Errorln("Error trying to \"delete\" a version")
-		http.Error(w, "problem trying to delete version", http.StatusInternalServerError)
-		return
+		}).Errorln("Error trying to yank or un-yank a version")
+		writeError(w, "problem trying to yank or un-yank version", http.StatusInternalServerError)
 	}
 }
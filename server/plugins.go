@@ -4,17 +4,28 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/sirupsen/logrus"
 	"gitlab.com/mstarongitlab/goutils/sliceutils"
 
+	"github.com/mstarongithub/mk-plugin-repo/aiscript"
 	"github.com/mstarongithub/mk-plugin-repo/storage"
 	customtypes "github.com/mstarongithub/mk-plugin-repo/storage/customTypes"
 )
 
+// Limits for the fields of NewPluginData and UpdatePluginData, in characters
+const (
+	MAX_PLUGIN_NAME_LENGTH   = 64
+	MAX_SUMMARY_SHORT_LENGTH = 256
+	MAX_SUMMARY_LONG_LENGTH  = 20000
+	MAX_TAGS                 = 20
+	MAX_TAG_LENGTH           = 32
+)
+
 // Data expected for making a new plugin via POST /api/v1/plugins
 type NewPluginData struct {
 	Name            string   `json:"name"`             // Name of the plugin
@@ -25,26 +36,38 @@ type NewPluginData struct {
 	Tags            []string `json:"tags"`             // The tags this plugin falls under
 	Type            string   `json:"type"`             // What type the plugin is. Valid values are "plugin" and "widget"
 	AIScriptVersion string   `json:"aiscript_version"` // The AI Script version this plugin is intended for
+	Signature       []byte   `json:"signature"`        // Optional detached ed25519 signature of the code, base64 encoded
+	KeyFingerprint  string   `json:"key_fingerprint"`  // Optional fingerprint of the key that made the signature
 }
 
 // Data a request to read a Plugin returns (GET /api/v1/plugins -> Array of this, GET /api/v1/plugins/{Plugin-id} -> One instance)
 type Plugin struct {
-	ID             uint     `json:"id"`              // The unique ID of the plugin
-	Name           string   `json:"name"`            // The name of the plugin
-	SummaryShort   string   `json:"summary_short"`   // A short summary of the plugin
-	SummaryLong    string   `json:"summary_long"`    // A full description of the plugin
-	CurrentVersion string   `json:"current_version"` // The latest version uploaded
-	AllVersions    []string `json:"all_versions"`    // All versions of this plugin that have been uploaded
-	Tags           []string `json:"tags"`            // All tags this plugin falls under
-	AuthorID       uint     `json:"author_id"`       // The ID of the author
-	Type           string   `json:"type"`            // Type of the plugin. Valid values are "plugin" and "widget"
+	ID             uint   `json:"id"`              // The unique ID of the plugin
+	Name           string `json:"name"`            // The name of the plugin
+	SummaryShort   string `json:"summary_short"`   // A short summary of the plugin
+	SummaryLong    string `json:"summary_long"`    // A full description of the plugin
+	CurrentVersion string `json:"current_version"` // The current version of the requested channel
+	// The current version of each channel that has one
+	CurrentVersions map[storage.Channel]string `json:"current_versions"`
+	AllVersions     []string                   `json:"all_versions"` // All versions of this plugin that have been uploaded
+	Tags            []string                   `json:"tags"`         // All tags this plugin falls under
+	AuthorID        uint                       `json:"author_id"`    // The ID of the author
+	Type            string                     `json:"type"`         // Type of the plugin. Valid values are "plugin" and "widget"
+	Maintainers     []uint                     `json:"maintainers"`  // IDs of accounts co-maintaining this plugin
+	Downloads       uint                       `json:"downloads"`    // How often the code of this plugin was fetched
+	Permissions     []string                   `json:"permissions"`  // Misskey permissions the current version requests
+	RiskLevel       string                     `json:"risk_level"`   // How risky the permissions of the current version are
+	// Review status of the plugin. Valid values are "pending", "approved" and "rejected"
+	ApprovalStatus  string `json:"approval_status"`
+	RejectionReason string `json:"rejection_reason,omitempty"` // Why a moderator rejected the plugin
 }
 
 // Data returned from GET /api/v1/plugins
 type PluginList struct {
 	Plugins []Plugin `json:"plugins"` // A list of plugins
-	Page    *int     `json:"page"`    // The current page you've received. Not set if only one page
-	Pages   *int     `json:"pages"`   // Total number of pages. Not set if only one page
+	Page    *int     `json:"page"`    // The current page you've received, starting at 1
+	Pages   *int     `json:"pages"`   // Total number of pages
+	Total   int64    `json:"total"`   // Total number of plugins matching the search
 }
 
 // Data expected for updating a plugin via PUT /api/v1/plugins/{plugin-id}
@@ -54,6 +77,57 @@ type UpdatePluginData struct {
 	SummaryLong  *string   `json:"summary_long,omitempty"`  // A full description of the plugin
 	Tags         *[]string `json:"tags,omitempty"`          // The tags this plugin falls under
 	Type         *string   `json:"type,omitempty"`          // What type the plugin is. Valid values are "plugin" and "widget"
+	Maintainers  *[]uint   `json:"maintainers,omitempty"`   // IDs of co-maintainers. Only the owner may change this
+}
+
+func (data *NewPluginData) validate() *ApiError {
+	if strings.TrimSpace(data.Code) == "" {
+		return missingField("code")
+	}
+	if data.Type == "" {
+		return missingField("type")
+	}
+	return validatePluginFields(&data.Name, &data.SummaryShort, &data.SummaryLong, &data.Tags, &data.Type)
+}
+
+// Only the fields that are set are checked
+func (data *UpdatePluginData) validate() *ApiError {
+	return validatePluginFields(data.Name, data.SummaryShort, data.SummaryLong, data.Tags, data.Type)
+}
+
+// Check the fields shared by NewPluginData and UpdatePluginData. Nil fields are skipped
+func validatePluginFields(name, summaryShort, summaryLong *string, tags *[]string, pluginType *string) *ApiError {
+	if name != nil {
+		if strings.TrimSpace(*name) == "" {
+			return missingField("name")
+		}
+		if utf8.RuneCountInString(*name) > MAX_PLUGIN_NAME_LENGTH {
+			return invalidField("name", "must be at most %d characters long", MAX_PLUGIN_NAME_LENGTH)
+		}
+	}
+	if summaryShort != nil && utf8.RuneCountInString(*summaryShort) > MAX_SUMMARY_SHORT_LENGTH {
+		return invalidField("summary_short", "must be at most %d characters long", MAX_SUMMARY_SHORT_LENGTH)
+	}
+	if summaryLong != nil && utf8.RuneCountInString(*summaryLong) > MAX_SUMMARY_LONG_LENGTH {
+		return invalidField("summary_long", "must be at most %d characters long", MAX_SUMMARY_LONG_LENGTH)
+	}
+	if tags != nil {
+		if len(*tags) > MAX_TAGS {
+			return invalidField("tags", "must have at most %d entries", MAX_TAGS)
+		}
+		for _, tag := range *tags {
+			if strings.TrimSpace(tag) == "" {
+				return invalidField("tags", "must not contain empty tags")
+			}
+			if utf8.RuneCountInString(tag) > MAX_TAG_LENGTH {
+				return invalidField("tags", "must only contain tags of at most %d characters", MAX_TAG_LENGTH)
+			}
+		}
+	}
+	if pluginType != nil && *pluginType != PLUGIN_TYPE_PLUGIN && *pluginType != PLUGIN_TYPE_WIDGET {
+		return invalidField("type", "must be %q or %q", PLUGIN_TYPE_PLUGIN, PLUGIN_TYPE_WIDGET)
+	}
+	return nil
 }
 
 // GET /api/v1/plugins
@@ -61,17 +135,133 @@ type UpdatePluginData struct {
 // Optional GET parameters:
 // - name: search for plugins containing the value in their name
 // - content: search for plugins containing the value in their description
-// - page: which "page" to select of the list of plugins
-// - tags: semicolon separated list of tags that must be included
-// TODO: Change return value to paginated version using PluginList
+// - page: which "page" to select of the list of plugins, starting at 1
+// - per_page: how many plugins to put on one page. Defaults to 25, at most 100
+// - tags: comma or semicolon separated list of tags that must be included. Semicolons must be percent-encoded
+// - type: only include plugins of that type. Either "plugin" or "widget"
+// - author: only include plugins by that author, given by account ID or name
+// - aiscript_version: only include plugins with a version that runs on that AiScript version
+// and show the newest such version as current
+// - misskey_version: like aiscript_version, for the AiScript version that Misskey version ships
+// - permissions: comma or semicolon separated list of permissions the current version must request
+// - exclude_permissions: comma or semicolon separated list of permissions the current version must not request
+// - max_risk: only include plugins whose current version is at most that risky. See aiscript.RiskLevels
+// With aiscript_version or misskey_version, the permission and risk filters apply to the version running on it
+// - sort: one of "newest" (default), "updated", "name" or "popularity"
+// - channel: only include plugins with a version in that channel and show that version as current.
+// One of "stable", "beta" or "prerelease". Filters on the current version still use the default one
+// Returns a json formatted PluginList
 func getPluginList(w http.ResponseWriter, r *http.Request) {
 	store := StorageFromRequest(r)
 	if store == nil {
 		logrus.Errorln("Couldn't get storage from context")
-		http.Error(w, "couldn't get storage from request context", http.StatusInternalServerError)
+		writeError(w, "couldn't get storage from request context", http.StatusInternalServerError)
+		return
+	}
+	query := r.URL.Query()
+	filter := storage.PluginFilter{
+		Name:      query.Get("name"),
+		Content:   query.Get("content"),
+		VisibleTo: AccountFromRequest(r),
+	}
+	filter.Tags = listFromQuery(query, "tags")
+	filter.Permissions = listFromQuery(query, "permissions")
+	filter.ExcludePermissions = listFromQuery(query, "exclude_permissions")
+	if maxRisk := query.Get("max_risk"); maxRisk != "" {
+		if !aiscript.IsRiskLevel(maxRisk) {
+			writeError(
+				w,
+				`max_risk must be one of "none", "read-only", "writes-content", "writes-account" or "admin"`,
+				http.StatusBadRequest,
+			)
+			return
+		}
+		level := aiscript.RiskLevel(maxRisk)
+		filter.MaxRisk = &level
+	}
+	var ok bool
+	if filter.Channel, ok = channelFromQuery(w, query); !ok {
+		return
+	}
+	if filter.AiScriptVersion, ok = aiscriptVersionFromQuery(w, query); !ok {
 		return
 	}
-	dbPlugins := store.GetAllPlugins()
+	if filter.Page, filter.PageSize, ok = pagingFromQuery(w, query); !ok {
+		return
+	}
+	if pluginTypeString := query.Get("type"); pluginTypeString != "" {
+		var pluginType customtypes.PluginType
+		switch pluginTypeString {
+		case PLUGIN_TYPE_PLUGIN:
+			pluginType = customtypes.PLUGIN_TYPE_PLUGIN
+		case PLUGIN_TYPE_WIDGET:
+			pluginType = customtypes.PLUGIN_TYPE_WIDGET
+		default:
+			writeError(w, `type must be either "plugin" or "widget"`, http.StatusBadRequest)
+			return
+		}
+		filter.Type = &pluginType
+	}
+	switch sort := query.Get("sort"); sort {
+	case "", storage.PLUGIN_SORT_NEWEST, storage.PLUGIN_SORT_UPDATED,
+		storage.PLUGIN_SORT_NAME, storage.PLUGIN_SORT_POPULARITY:
+		filter.Sort = sort
+	default:
+		writeError(
+			w,
+			`sort must be one of "newest", "updated", "name" or "popularity"`,
+			http.StatusBadRequest,
+		)
+		return
+	}
+	if author := query.Get("author"); author != "" {
+		if authorID, err := strconv.ParseUint(author, 10, 0); err == nil {
+			id := uint(authorID)
+			filter.AuthorID = &id
+		} else {
+			acc, err := store.FindAccountByName(author)
+			if err != nil && !errors.Is(err, storage.ErrAccountNotFound) {
+				logrus.WithError(err).WithField("author", author).Errorln("Failed to look up author")
+				writeError(w, "failed to look up author", http.StatusInternalServerError)
+				return
+			}
+			// Unknown authors have no plugins. ID 0 is never assigned, so nothing matches
+			id := uint(0)
+			if acc != nil {
+				id = acc.ID
+			}
+			filter.AuthorID = &id
+		}
+	}
+
+	dbPlugins, total, err := store.FindPlugins(filter)
+	if err != nil {
+		logrus.WithError(err).WithField("filter", filter).Errorln("Failed to search plugins")
+		writeError(w, "failed to search plugins", http.StatusInternalServerError)
+		return
+	}
+	if filter.AiScriptVersion != "" {
+		for i := range dbPlugins {
+			err = store.PluginForAiScript(&dbPlugins[i], &filter)
+			if err != nil {
+				logrus.WithError(err).
+					WithField("pluginID", dbPlugins[i].ID).
+					Errorln("Failed to get compatible version of plugin")
+				writeError(w, "failed to get compatible versions", http.StatusInternalServerError)
+				return
+			}
+		}
+	} else if filter.Channel != nil {
+		for i := range dbPlugins {
+			if err = store.PluginInChannel(&dbPlugins[i], *filter.Channel); err != nil {
+				logrus.WithError(err).
+					WithField("pluginID", dbPlugins[i].ID).
+					Errorln("Failed to get channel version of plugin")
+				writeError(w, "failed to get channel versions", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
 	apiPlugins := sliceutils.Map(dbPlugins, func(p storage.Plugin) Plugin {
 		return dbPluginToApiPlugin(&p)
 	})
@@ -79,17 +269,23 @@ func getPluginList(w http.ResponseWriter, r *http.Request) {
 		"db-plugins":  dbPlugins,
 		"api-plugins": apiPlugins,
 	}).Debugln("Found plugins with conversion")
-	if len(dbPlugins) == 0 {
-		return
+
+	page := max(filter.Page, 1)
+	pages := pageCount(total, filter.EffectivePageSize())
+	list := PluginList{
+		Plugins: apiPlugins,
+		Page:    &page,
+		Pages:   &pages,
+		Total:   total,
 	}
 
-	r.Header.Add("Content-Type", "application/json")
-	data, err := json.Marshal(apiPlugins)
+	w.Header().Set("Content-Type", "application/json")
+	data, err := json.Marshal(&list)
 	if err != nil {
 		logrus.WithError(err).
 			WithField("plugins", apiPlugins).
 			Errorln("Failed to convert plugins to json")
-		http.Error(w, "json conversion failed", http.StatusInternalServerError)
+		writeError(w, "json conversion failed", http.StatusInternalServerError)
 		return
 	}
 	fmt.Fprint(w, string(data))
@@ -100,49 +296,38 @@ func getPluginList(w http.ResponseWriter, r *http.Request) {
 // Add a new plugin to the repo
 // New plugins will only be available after approval from an admin
 // Body must be a json version of NewPluginData
+// Returns 400 or 413 with an ApiError if the body is invalid
+// Returns 422 with an ApiError if the code has a syntax error, its metadata is malformed or contradicts the submitted data
+// or the signature doesn't match
 func addNewPlugin(w http.ResponseWriter, r *http.Request) {
 	store := StorageFromRequest(r)
 	// ab := AuthbossFromRequest(r)
 	if store == nil {
 		logrus.Errorln("addNewPlugin: Couldn't get storage from request context")
-		http.Error(w, "couldn't get storage from request context", http.StatusInternalServerError)
+		writeError(w, "couldn't get storage from request context", http.StatusInternalServerError)
 		return
 	}
 	// if ab == nil {
 	// logrus.Errorln("addNewPlugin: Couldn't get auth layer from request context")
-	// 	http.Error(
+	// 	writeError(
 	// 		w,
 	// 		"couldn't get auth layer from request context",
 	// 		http.StatusInternalServerError,
 	// 	)
 	// 	return
 	// }
-	body, _ := io.ReadAll(r.Body)
-
 	newPlugin := NewPluginData{}
-	err := json.Unmarshal(body, &newPlugin)
-	if err != nil {
-		logrus.WithError(err).
-			WithField("body", string(body)).
-			Errorln("Failed to parse json from body")
-		http.Error(
-			w,
-			"body must be a json-encoded representation of NewPluginData",
-			http.StatusBadRequest,
-		)
+	if !decodeBody(w, r, &newPlugin, maxBodySize(true)) {
 		return
 	}
 	// Get user ID to use as author id
-	// stringUID, _ := ab.CurrentUserID(r)
-	stringUID := "12345" // FIX: Remove this line and uncomment the one above. This is for debug purposes
-	uid, err := strconv.ParseUint(stringUID, 10, 0)
-	if err != nil {
-		logrus.WithError(err).
-			WithField("userID", stringUID).
-			Infoln("Failed to parse userId. Refusing access")
-		http.Error(w, "invalid user id", http.StatusUnauthorized)
+	acc := AccountFromRequest(r)
+	if acc == nil {
+		logrus.Infoln("addNewPlugin: Request not authenticated. Refusing access")
+		writeError(w, "not logged in", http.StatusUnauthorized)
 		return
 	}
+	uid := acc.ID
 
 	// And now parse the plugin type
 	var pluginType customtypes.PluginType
@@ -152,40 +337,65 @@ func addNewPlugin(w http.ResponseWriter, r *http.Request) {
 	case "widget":
 		pluginType = customtypes.PLUGIN_TYPE_WIDGET
 	}
+	meta, versionName, aiscriptVersion, ok := checkCodeMetadata(
+		w,
+		newPlugin.Code,
+		newPlugin.InitialVersion,
+		newPlugin.AIScriptVersion,
+	)
+	if !ok {
+		return
+	}
+	signature, ok := checkCodeSignature(w, store, acc, newPlugin.Code, newPlugin.Signature, newPlugin.KeyFingerprint)
+	if !ok {
+		return
+	}
 	// Then try throwing it into the db
 	logrus.WithFields(logrus.Fields{
 		"plugin": newPlugin,
 		"uid":    uid,
 	}).Debugln("Attempting to add plugin to db")
-	_, err = store.NewPlugin(
+	_, err := store.NewPlugin(
 		newPlugin.Name,
-		uint(uid),
-		newPlugin.InitialVersion,
+		uid,
+		versionName,
 		newPlugin.SummaryLong,
 		newPlugin.SummaryShort,
 		newPlugin.Tags,
 		pluginType,
 		newPlugin.Code,
-		newPlugin.AIScriptVersion,
+		aiscriptVersion,
+		meta,
+		signature,
 	)
 	if err != nil {
-		logrus.WithError(err).WithField("plugin", newPlugin).Errorln("Failed to add plugin to db")
-		http.Error(
-			w,
-			fmt.Sprintf("failed to insert new plugin. Error: %s", err.Error()),
-			http.StatusInternalServerError,
-		)
+		switch {
+		case errors.Is(err, storage.ErrAccountNotApproved):
+			logrus.WithField("uid", uid).Infoln("Unapproved account tried to add a plugin")
+			writeError(w, "your account has not been approved yet", http.StatusForbidden)
+		case errors.Is(err, storage.ErrAlreadyExists):
+			writeError(w, "a plugin with that name already exists", http.StatusConflict)
+		default:
+			logrus.WithError(err).WithField("plugin", newPlugin).Errorln("Failed to add plugin to db")
+			writeError(
+				w,
+				fmt.Sprintf("failed to insert new plugin. Error: %s", err.Error()),
+				http.StatusInternalServerError,
+			)
+		}
+		return
 	}
 	w.WriteHeader(http.StatusCreated)
 }
 
 // GET /api/v1/plugins/{pluginId}
 // Get a specific plugin, specified by {plugin-id}
+// Optional GET parameter "channel" shows the current version of that channel instead. 404 if it has none
 func getSpecificPlugin(w http.ResponseWriter, r *http.Request) {
 	store := StorageFromRequest(r)
 	if store == nil {
 		// TODO: Add logging
-		http.Error(
+		writeError(
 			w,
 			"couldn't get data layer from request context",
 			http.StatusInternalServerError,
@@ -196,7 +406,7 @@ func getSpecificPlugin(w http.ResponseWriter, r *http.Request) {
 	pluginID := r.PathValue("pluginId")
 	if pluginID == "" {
 		// TODO: Add logging
-		http.Error(
+		writeError(
 			w,
 			"missing plugin id. Endpoint usage: GET /api/v1/plugins/{plugin-id}",
 			http.StatusBadRequest,
@@ -206,24 +416,46 @@ func getSpecificPlugin(w http.ResponseWriter, r *http.Request) {
 	pID, err := strconv.ParseUint(pluginID, 10, 0)
 	if err != nil {
 		// TODO: Add logging
-		http.Error(w, "bad plugin ID", http.StatusBadRequest)
+		writeError(w, "bad plugin ID", http.StatusBadRequest)
 		return
 	}
 	storagePlugin, err := store.GetPluginByID(uint(pID))
 	if err != nil {
 		// TODO: Add logging
 		if errors.Is(err, storage.ErrPluginNotFound) {
-			http.Error(w, "plugin not found", http.StatusNotFound)
+			writeError(w, "plugin not found", http.StatusNotFound)
 		} else {
-			http.Error(w, "error getting plugin from storage layer", http.StatusInternalServerError)
+			writeError(w, "error getting plugin from storage layer", http.StatusInternalServerError)
 		}
 		return
 	}
+	// Unapproved plugins don't exist for anyone but their maintainers and moderators
+	if !storagePlugin.VisibleTo(AccountFromRequest(r)) {
+		writeError(w, "plugin not found", http.StatusNotFound)
+		return
+	}
+	channel, ok := channelFromQuery(w, r.URL.Query())
+	if !ok {
+		return
+	}
+	if channel != nil {
+		err = store.PluginInChannel(storagePlugin, *channel)
+		if errors.Is(err, storage.ErrNoVersionInChannel) {
+			writeError(w, "plugin has no version in this channel", http.StatusNotFound)
+			return
+		} else if err != nil {
+			logrus.WithError(err).
+				WithField("pluginID", storagePlugin.ID).
+				Errorln("Failed to get channel version of plugin")
+			writeError(w, "failed to get channel version", http.StatusInternalServerError)
+			return
+		}
+	}
 	apiPlugin := dbPluginToApiPlugin(storagePlugin)
 	jbody, err := json.Marshal(&apiPlugin)
 	if err != nil {
 		// TODO: Add logging
-		http.Error(w, "json encoding failed", http.StatusInternalServerError)
+		writeError(w, "json encoding failed", http.StatusInternalServerError)
 		return
 	}
 	// TODO: Add logging: Plugin requested
@@ -233,17 +465,19 @@ func getSpecificPlugin(w http.ResponseWriter, r *http.Request) {
 // PUT /api/v1/plugins/{pluginId}
 // RESTRICTED
 // Update a specific plugin
+// Body must be a json version of UpdatePluginData
+// Returns 400 or 413 with an ApiError if the body is invalid
 func updateSpecificPlugin(w http.ResponseWriter, r *http.Request) {
 	store := StorageFromRequest(r)
 	// ab := AuthbossFromRequest(r)
 	if store == nil {
 		// TODO: Add logging
-		http.Error(w, "couldn't get storage from request context", http.StatusInternalServerError)
+		writeError(w, "couldn't get storage from request context", http.StatusInternalServerError)
 		return
 	}
 	// if ab == nil {
 	//  // TODO: Add logging
-	// 	http.Error(
+	// 	writeError(
 	// 		w,
 	// 		"couldn't get auth layer from request context",
 	// 		http.StatusInternalServerError,
@@ -251,21 +485,20 @@ func updateSpecificPlugin(w http.ResponseWriter, r *http.Request) {
 	// 	return
 	// }
 
-	// Get and parse user id and plugin id
-	//suID, _ := ab.CurrentUserID(r)
-	suID := "12345" // FIX: Remove this line and uncomment the one above. This is for debug purposes
-	uid, err := strconv.ParseUint(suID, 10, 0)
-	if err != nil {
+	// Get user id and parse plugin id
+	acc := AccountFromRequest(r)
+	if acc == nil {
 		// TODO: Add logging
-		http.Error(w, "bad authentication", http.StatusUnauthorized)
+		writeError(w, "not logged in", http.StatusUnauthorized)
 		return
 	}
+	uid := acc.ID
 
 	pluginString := r.PathValue("pluginId")
 	pluginID, err := strconv.ParseUint(pluginString, 10, 0)
 	if err != nil {
 		// TODO: Add logging
-		http.Error(w, "bad plugin id. Must be a uint", http.StatusBadRequest)
+		writeError(w, "bad plugin id. Must be a uint", http.StatusBadRequest)
 		return
 	}
 
@@ -275,23 +508,28 @@ func updateSpecificPlugin(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		if errors.Is(err, storage.ErrPluginNotFound) {
 			// TODO: Add logging
-			http.Error(w, "plugin not found", http.StatusNotFound)
+			writeError(w, "plugin not found", http.StatusNotFound)
 		} else {
 			// TODO: Add logging
-			http.Error(w, "problem getting plugin from storage layer", http.StatusInternalServerError)
+			writeError(w, "problem getting plugin from storage layer", http.StatusInternalServerError)
 		}
 		return
 	}
-	// Check if the user authenticated is actually allowed to edit this plugin (aka is the owner)
-	if plugin.AuthorID != uint(uid) {
-		// TODO: Add logging
-		http.Error(w, "you're not the owner of the plugin", http.StatusUnauthorized)
+	// Check if the user authenticated is actually allowed to edit this plugin
+	// (aka is the owner, a co-maintainer or a moderator)
+	if !plugin.CanBeManagedBy(acc) {
+		logrus.WithFields(logrus.Fields{
+			"pluginID": pluginID,
+			"uid":      uid,
+		}).Infoln("Account tried to update plugin it doesn't maintain")
+		writeError(w, "you're not a maintainer of the plugin", http.StatusForbidden)
 		return
 	}
 
-	body, _ := io.ReadAll(r.Body) // FIXME: Properly handle error
 	updateData := UpdatePluginData{}
-	_ = json.Unmarshal(body, &updateData) // FIXME: Properly handle error
+	if !decodeBody(w, r, &updateData, maxBodySize(false)) {
+		return
+	}
 
 	// TODO: Add logging: What to update
 	if updateData.Name != nil {
@@ -314,9 +552,26 @@ func updateSpecificPlugin(w http.ResponseWriter, r *http.Request) {
 	if updateData.SummaryLong != nil {
 		plugin.SummaryLong = *updateData.SummaryLong
 	}
+	if updateData.Maintainers != nil {
+		// Co-maintainers must not be able to add or remove other maintainers
+		if !plugin.CanBeDeletedBy(acc) {
+			writeError(w, "only the owner can change the maintainers", http.StatusForbidden)
+			return
+		}
+		plugin.Maintainers = *updateData.Maintainers
+	}
 
-	// TODO: Add logging: Update action
-	_ = store.UpdatePlugin(plugin)
+	// Changes by the author address the rejection reasons, so the plugin goes back into the queue
+	if plugin.Rejected && !acc.CanApprovePlugins {
+		plugin.Rejected = false
+		logrus.WithField("pluginID", pluginID).Infoln("Rejected plugin updated, resubmitting for review")
+	}
+
+	if err = store.UpdatePlugin(plugin); err != nil {
+		logrus.WithError(err).WithField("pluginID", pluginID).Errorln("Failed to update plugin")
+		writeError(w, "failed to update plugin", http.StatusInternalServerError)
+		return
+	}
 }
 
 // DELETE /api/v1/plugins/{pluginId}
@@ -328,12 +583,12 @@ func deleteSpecificPlugin(w http.ResponseWriter, r *http.Request) {
 	// ab := AuthbossFromRequest(r)
 	if store == nil {
 		// TODO: Add logging
-		http.Error(w, "couldn't get storage from request context", http.StatusInternalServerError)
+		writeError(w, "couldn't get storage from request context", http.StatusInternalServerError)
 		return
 	}
 	// if ab == nil {
 	//  // TODO: Add logging
-	// 	http.Error(
+	// 	writeError(
 	// 		w,
 	// 		"couldn't get auth layer from request context",
 	// 		http.StatusInternalServerError,
@@ -341,28 +596,34 @@ func deleteSpecificPlugin(w http.ResponseWriter, r *http.Request) {
 	// 	return
 	// }
 
-	// Get and parse user id and plugin id
-	//suID, _ := ab.CurrentUserID(r)
-	suID := "12345" // FIX: Remove this line and uncomment the one above. This is for debug purposes
-	uid, err := strconv.ParseUint(suID, 10, 0)
-	if err != nil {
+	// Get user id and parse plugin id
+	acc := AccountFromRequest(r)
+	if acc == nil {
 		// TODO: Add logging
-		http.Error(w, "bad authentication", http.StatusUnauthorized)
+		writeError(w, "not logged in", http.StatusUnauthorized)
 		return
 	}
+	uid := acc.ID
 
 	pluginString := r.PathValue("pluginId")
 	pluginID, err := strconv.ParseUint(pluginString, 10, 0)
 	if err != nil {
 		// TODO: Add logging
-		http.Error(w, "bad plugin id. Must be a uint", http.StatusBadRequest)
+		writeError(w, "bad plugin id. Must be a uint", http.StatusBadRequest)
 		return
 	}
 
-	// TODO: Add logging: About to attempt plugin deletion with plugin and user id
-	err = store.DeletePlugin(uint(pluginID), uint(uid))
+	logrus.WithFields(logrus.Fields{
+		"pluginID": pluginID,
+		"uid":      uid,
+	}).Debugln("Attempting plugin deletion")
+	err = store.DeletePlugin(uint(pluginID), acc)
 	if err != nil {
-		// TODO: Add logging
-		http.Error(w, "couldn't delete plugin", http.StatusInternalServerError)
+		if errors.Is(err, storage.ErrUnauthorised) {
+			writeError(w, "you're not allowed to delete this plugin", http.StatusForbidden)
+			return
+		}
+		logrus.WithError(err).WithField("pluginID", pluginID).Errorln("Failed to delete plugin")
+		writeError(w, "couldn't delete plugin", http.StatusInternalServerError)
 	}
 }
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gitlab.com/mstarongitlab/goutils/sliceutils"
+
+	"github.com/mstarongithub/mk-plugin-repo/storage"
+)
+
+// A plugin found by a full-text search
+type SearchResult struct {
+	Plugin Plugin `json:"plugin"` // The plugin that matched
+	// Html excerpt of the best matching field with matches wrapped in <mark> tags
+	// Everything else is escaped. Empty if the server doesn't support full-text search
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"` // How well the plugin matched. Lower is better
+}
+
+// Response for a full-text search
+type SearchResults struct {
+	Results []SearchResult `json:"results"` // The results on the requested page, best match first
+	Page    int            `json:"page"`    // The requested page, starting at 1
+	Pages   int            `json:"pages"`   // How many pages there are in total
+	Total   int64          `json:"total"`   // How many plugins matched in total
+}
+
+// GET /api/v1/search
+// Full-text search over the names, descriptions, tags and current code of plugins
+// GET parameters:
+// - q: the text to search for. Required. Plugins must contain all words, the last one may be incomplete
+// - page: which page of results to get, starting at 1
+// - per_page: how many results to put on one page. Defaults to 25, at most 100
+// Returns a json formatted SearchResults
+func searchPlugins(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("searchPlugins: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	query := r.URL.Query()
+	text := strings.TrimSpace(query.Get("q"))
+	if text == "" {
+		writeError(w, "missing search text in parameter q", http.StatusBadRequest)
+		return
+	}
+	page, perPage, ok := pagingFromQuery(w, query)
+	if !ok {
+		return
+	}
+	page = max(page, 1)
+
+	results, total, err := store.SearchPlugins(text, AccountFromRequest(r), page, perPage)
+	if err != nil {
+		logrus.WithError(err).WithField("query", text).Errorln("Failed to search plugins")
+		writeError(w, "failed to search plugins", http.StatusInternalServerError)
+		return
+	}
+	jbody, err := json.Marshal(&SearchResults{
+		Results: sliceutils.Map(results, func(res storage.PluginSearchResult) SearchResult {
+			return SearchResult{
+				Plugin:  dbPluginToApiPlugin(&res.Plugin),
+				Snippet: res.Snippet,
+				Rank:    res.Rank,
+			}
+		}),
+		Page:  page,
+		Pages: pageCount(total, storage.EffectivePageSize(perPage)),
+		Total: total,
+	})
+	if err != nil {
+		logrus.WithError(err).Errorln("searchPlugins: Failed to marshal results")
+		writeError(w, "json encoding failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jbody)
+}
@@ -12,6 +12,7 @@ import (
 	_ "github.com/volatiletech/authboss/v3/lock"
 	"github.com/volatiletech/authboss/v3/remember"
 
+	"github.com/mstarongithub/mk-plugin-repo/auth"
 	"github.com/mstarongithub/mk-plugin-repo/storage"
 )
 
@@ -20,6 +21,7 @@ type Server struct {
 	handler    http.Handler
 	frontendFS fs.FS
 	authboss   *authboss.Authboss
+	auth       *auth.AuthManager
 }
 
 type ServerContextKey string
@@ -28,6 +30,7 @@ const (
 	CONTEXT_KEY_SERVER     = ServerContextKey("server")
 	CONTEXT_KEY_STORAGE    = ServerContextKey("storage")
 	CONTEXT_KEY_AUTHBOSS   = ServerContextKey("authboss")
+	CONTEXT_KEY_AUTH       = ServerContextKey("auth")
 	CONTEXT_KEY_CSRF_TOKEN = ServerContextKey("csrf_token")
 )
 
@@ -35,6 +38,7 @@ func NewServer(
 	frontendFS fs.FS,
 	ab *authboss.Authboss,
 	store *storage.Storage,
+	authManager *auth.AuthManager,
 ) (*Server, error) {
 	mainRouter := http.NewServeMux()
 
@@ -49,6 +53,7 @@ func NewServer(
 		handler:    nil,
 		frontendFS: frontendFS,
 		authboss:   ab,
+		auth:       authManager,
 	}
 
 	server.handler = ChainMiddlewares(
@@ -58,8 +63,10 @@ func NewServer(
 				CONTEXT_KEY_SERVER:   &server,
 				CONTEXT_KEY_STORAGE:  store,
 				CONTEXT_KEY_AUTHBOSS: ab,
+				CONTEXT_KEY_AUTH:     authManager,
 			},
 		),
+		authManager.Middleware,
 		cors.AllowAll().Handler,
 		ab.LoadClientStateMiddleware,
 		remember.Middleware(ab),
@@ -112,7 +119,20 @@ func buildV1Router(ab *authboss.Authboss) http.Handler {
 
 	router.HandleFunc("GET /plugins", getPluginList)
 	router.HandleFunc("GET /plugins/{pluginId}", getSpecificPlugin)
+	router.HandleFunc("GET /plugins/{pluginId}/diff", getVersionDiff)
+	router.HandleFunc("GET /plugins/{pluginId}/versions", getVersionHistory)
 	router.HandleFunc("GET /plugins/{pluginId}/{versionName}", getVersion)
+	router.HandleFunc("GET /plugins/{pluginId}/latest/raw", getVersionRaw)
+	router.HandleFunc("GET /plugins/{pluginId}/{versionName}/raw", getVersionRaw)
+	router.HandleFunc("GET /plugins/{pluginId}/latest/install", getInstallLink)
+	router.HandleFunc("GET /plugins/{pluginId}/{versionName}/install", getInstallLink)
+	router.HandleFunc("GET /plugins/{pluginId}/{versionName}/install.json5", getInstallPayload)
+	router.HandleFunc("GET /plugins/{pluginId}/{versionName}/lint", getVersionLint)
+	router.HandleFunc("GET /accounts/{accountId}/keys", getAccountSigningKeys)
+	router.HandleFunc("GET /search", searchPlugins)
+	router.HandleFunc("POST /updates", checkUpdates)
+	router.HandleFunc("POST /auth/register", register)
+	router.HandleFunc("POST /auth/login", login)
 	router.Handle("/", buildV1RestrictedRouter(ab))
 
 	return router
@@ -121,18 +141,69 @@ func buildV1Router(ab *authboss.Authboss) http.Handler {
 func buildV1RestrictedRouter(ab *authboss.Authboss) http.Handler {
 	router := http.NewServeMux()
 
-	router.HandleFunc("POST /plugins", addNewPlugin)
-	router.HandleFunc("PUT /plugins/{pluginId}", updateSpecificPlugin)
-	router.HandleFunc("POST /plugins/{pluginId}", newVersion)
-	router.HandleFunc("DELETE /plugins/{pluginId}", deleteSpecificPlugin)
-	router.HandleFunc("DELETE /plugins/[pluginId]/{versionName}", hideVersion)
+	pluginsWrite := RequireScope(storage.TOKEN_SCOPE_PLUGINS_WRITE)
+	versionsPublish := RequireScope(storage.TOKEN_SCOPE_VERSIONS_PUBLISH)
 
-	// handler := ChainMiddlewares(
-	// 	router,
-	// 	authboss.Middleware2(ab, authboss.RequireNone, authboss.RespondUnauthorized),
-	// 	lock.Middleware(ab),
-	// 	confirm.Middleware(ab),
-	// )
+	router.Handle("POST /plugins", pluginsWrite(http.HandlerFunc(addNewPlugin)))
+	router.Handle("PUT /plugins/{pluginId}", pluginsWrite(http.HandlerFunc(updateSpecificPlugin)))
+	router.Handle("POST /plugins/{pluginId}", versionsPublish(http.HandlerFunc(newVersion)))
+	router.Handle("DELETE /plugins/{pluginId}", pluginsWrite(http.HandlerFunc(deleteSpecificPlugin)))
+	router.Handle(
+		"DELETE /plugins/{pluginId}/{versionName}",
+		versionsPublish(http.HandlerFunc(yankVersion)),
+	)
+	router.Handle(
+		"POST /plugins/{pluginId}/{versionName}/yank",
+		versionsPublish(http.HandlerFunc(yankVersion)),
+	)
+	router.Handle(
+		"POST /plugins/{pluginId}/{versionName}/unyank",
+		versionsPublish(http.HandlerFunc(unyankVersion)),
+	)
+	router.HandleFunc("POST /auth/logout", logout)
+	router.HandleFunc("GET /auth/me", getOwnAccount)
+	router.Handle("GET /tokens", RequireSession(http.HandlerFunc(getAccessTokens)))
+	router.Handle("POST /tokens", RequireSession(http.HandlerFunc(newAccessToken)))
+	router.Handle("DELETE /tokens/{tokenId}", RequireSession(http.HandlerFunc(revokeAccessToken)))
+	router.Handle("GET /keys", RequireSession(http.HandlerFunc(getOwnSigningKeys)))
+	router.Handle("POST /keys", RequireSession(http.HandlerFunc(newSigningKey)))
+	router.Handle("DELETE /keys/{keyId}", RequireSession(http.HandlerFunc(revokeSigningKey)))
+	router.Handle("/admin/", http.StripPrefix("/admin", buildV1AdminRouter()))
+
+	return ChainMiddlewares(router, RequireAuthentication)
+}
 
-	return router
+// Router for moderation endpoints. Only usable by moderators and never with access tokens
+func buildV1AdminRouter() http.Handler {
+	router := http.NewServeMux()
+
+	router.Handle("GET /queue", RequirePluginModerator(http.HandlerFunc(getPluginQueue)))
+	router.Handle(
+		"POST /queue/{pluginId}/approve",
+		RequirePluginModerator(http.HandlerFunc(approvePlugin)),
+	)
+	router.Handle(
+		"POST /queue/{pluginId}/reject",
+		RequirePluginModerator(http.HandlerFunc(rejectPlugin)),
+	)
+	router.Handle("GET /versions", RequirePluginModerator(http.HandlerFunc(getHeldVersions)))
+	router.Handle(
+		"POST /versions/{pluginId}/{versionName}/approve",
+		RequirePluginModerator(http.HandlerFunc(approveVersion)),
+	)
+	router.Handle(
+		"POST /versions/{pluginId}/{versionName}/reject",
+		RequirePluginModerator(http.HandlerFunc(rejectVersion)),
+	)
+	router.Handle("GET /accounts", RequireUserModerator(http.HandlerFunc(getAccountQueue)))
+	router.Handle(
+		"POST /accounts/{accountId}/approve",
+		RequireUserModerator(http.HandlerFunc(approveAccount)),
+	)
+	router.Handle(
+		"POST /accounts/{accountId}/reject",
+		RequireUserModerator(http.HandlerFunc(rejectAccount)),
+	)
+
+	return ChainMiddlewares(router, RequireSession)
 }
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gitlab.com/mstarongitlab/goutils/sliceutils"
+
+	"github.com/mstarongithub/mk-plugin-repo/storage"
+)
+
+// Data expected for registering a new signing key via POST /api/v1/keys
+type NewSigningKeyData struct {
+	Name      string `json:"name"`       // A name to identify the key by
+	PublicKey []byte `json:"public_key"` // The raw 32 byte ed25519 public key, base64 encoded
+}
+
+func (data *NewSigningKeyData) validate() *ApiError {
+	if data.Name == "" {
+		return missingField("name")
+	}
+	return nil
+}
+
+// Data returned about a signing key
+type SigningKeyInfo struct {
+	ID          uint       `json:"id"`          // The ID of the key
+	AccountID   uint       `json:"account_id"`  // The account owning the key
+	Name        string     `json:"name"`        // The name of the key
+	PublicKey   []byte     `json:"public_key"`  // The raw ed25519 public key, base64 encoded
+	Fingerprint string     `json:"fingerprint"` // "SHA256:" followed by the unpadded base64 of the SHA-256 of the key
+	CreatedAt   time.Time  `json:"created_at"`  // When the key was registered
+	RevokedAt   *time.Time `json:"revoked_at"`  // When the key was revoked. Null if it is still active
+}
+
+// GET /api/v1/keys
+// RESTRICTED, session only
+// Get the active signing keys of the current account
+// Returns a json array of SigningKeyInfo
+func getOwnSigningKeys(w http.ResponseWriter, r *http.Request) {
+	writeSigningKeys(w, r, AccountFromRequest(r).ID, false)
+}
+
+// GET /api/v1/accounts/{accountId}/keys
+// Get all signing keys an account ever registered, including revoked ones,
+// so that signatures of older versions can be verified offline
+// Returns a json array of SigningKeyInfo
+func getAccountSigningKeys(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.ParseUint(r.PathValue("accountId"), 10, 0)
+	if err != nil {
+		writeError(w, "bad account id. Must be a uint", http.StatusBadRequest)
+		return
+	}
+	writeSigningKeys(w, r, uint(accountID), true)
+}
+
+func writeSigningKeys(w http.ResponseWriter, r *http.Request, accountID uint, includeRevoked bool) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("writeSigningKeys: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	if _, err := store.FindAccountByID(accountID); err != nil {
+		if errors.Is(err, storage.ErrAccountNotFound) {
+			writeError(w, "account not found", http.StatusNotFound)
+			return
+		}
+		logrus.WithError(err).WithField("accountID", accountID).Errorln("Failed to get account")
+		writeError(w, "failed to get account", http.StatusInternalServerError)
+		return
+	}
+	keys, err := store.GetSigningKeysFor(accountID, includeRevoked)
+	if err != nil {
+		logrus.WithError(err).WithField("accountID", accountID).Errorln("Failed to get signing keys")
+		writeError(w, "failed to get signing keys", http.StatusInternalServerError)
+		return
+	}
+	infos := sliceutils.Map(keys, func(k storage.SigningKey) SigningKeyInfo {
+		return dbSigningKeyToSigningKeyInfo(&k)
+	})
+	jbody, err := json.Marshal(infos)
+	if err != nil {
+		logrus.WithError(err).Errorln("writeSigningKeys: Failed to marshal keys")
+		writeError(w, "json encoding failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jbody)
+}
+
+// POST /api/v1/keys
+// RESTRICTED, session only
+// Register a new ed25519 public key for the current account
+// Body must be a json-encoded NewSigningKeyData
+// Returns the SigningKeyInfo of the new key. 409 if the key is already registered
+func newSigningKey(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("newSigningKey: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	acc := AccountFromRequest(r)
+	data := NewSigningKeyData{}
+	if !decodeBody(w, r, &data, maxBodySize(false)) {
+		return
+	}
+
+	key, err := store.NewSigningKey(acc.ID, data.Name, data.PublicKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrInvalidPublicKey):
+			writeError(w, "public key must be 32 bytes of a raw ed25519 key", http.StatusBadRequest)
+		case errors.Is(err, storage.ErrKeyAlreadyExists):
+			writeError(w, "key is already registered", http.StatusConflict)
+		default:
+			logrus.WithError(err).WithField("accountID", acc.ID).Errorln("Failed to register signing key")
+			writeError(w, "failed to register signing key", http.StatusInternalServerError)
+		}
+		return
+	}
+	jbody, err := json.Marshal(dbSigningKeyToSigningKeyInfo(key))
+	if err != nil {
+		logrus.WithError(err).Errorln("newSigningKey: Failed to marshal key")
+		writeError(w, "json encoding failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jbody)
+}
+
+// DELETE /api/v1/keys/{keyId}
+// RESTRICTED, session only
+// Revoke a signing key of the current account. Versions it signed stay signed
+func revokeSigningKey(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("revokeSigningKey: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	acc := AccountFromRequest(r)
+	keyID, err := strconv.ParseUint(r.PathValue("keyId"), 10, 0)
+	if err != nil {
+		writeError(w, "bad key id. Must be a uint", http.StatusBadRequest)
+		return
+	}
+	if err = store.RevokeSigningKey(acc.ID, uint(keyID)); err != nil {
+		if errors.Is(err, storage.ErrSigningKeyNotFound) {
+			writeError(w, "signing key not found", http.StatusNotFound)
+			return
+		}
+		logrus.WithError(err).WithField("keyID", keyID).Errorln("Failed to revoke signing key")
+		writeError(w, "failed to revoke signing key", http.StatusInternalServerError)
+	}
+}
+
+// Verify the signature uploaded with new code against the keys of the uploading account
+// Returns nil and ok=true if no signature was uploaded
+// Writes 422 with an ApiError to the response and returns ok=false if the signature doesn't match
+func checkCodeSignature(
+	w http.ResponseWriter,
+	store *storage.Storage,
+	acc *storage.Account,
+	code string,
+	signature []byte,
+	fingerprint string,
+) (verified *storage.CodeSignature, ok bool) {
+	if len(signature) == 0 {
+		if fingerprint != "" {
+			writeRequestError(w, &ApiError{
+				Error:   REQUEST_ERROR_MISSING_FIELD,
+				Message: "key_fingerprint is set, but no signature",
+				Field:   "signature",
+			})
+			return nil, false
+		}
+		return nil, true
+	}
+	verified, err := store.VerifyCodeSignature(acc.ID, code, signature, fingerprint)
+	if errors.Is(err, storage.ErrInvalidSignature) {
+		writeCodeError(w, &ApiError{
+			Error:   CODE_ERROR_INVALID_SIGNATURE,
+			Message: "signature doesn't match the code with any active key of the account",
+		})
+		return nil, false
+	} else if err != nil {
+		logrus.WithError(err).WithField("accountID", acc.ID).Errorln("Failed to verify code signature")
+		writeError(w, "failed to verify signature", http.StatusInternalServerError)
+		return nil, false
+	}
+	return verified, true
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/mstarongithub/mk-plugin-repo/aiscript"
+	"github.com/mstarongithub/mk-plugin-repo/storage"
+)
+
+// How many plugins can be checked for updates in one request
+const MAX_UPDATE_CHECKS = 100
+
+const (
+	UPDATE_ERROR_INVALID_CHECK  = "invalid_check"         // Neither plugin ID nor name or no installed version given
+	UPDATE_ERROR_NOT_FOUND      = "plugin_not_found"      // No visible plugin with that ID or name
+	UPDATE_ERROR_AMBIGUOUS_NAME = "ambiguous_name"        // Several plugins have that name. The ID has to be used
+	UPDATE_ERROR_NO_VERSION     = "no_compatible_version" // No version of the plugin runs on the AiScript version
+	UPDATE_ERROR_BAD_RUNTIME    = "invalid_runtime"       // The AiScript or Misskey version isn't valid or known
+)
+
+// One installed plugin sent to POST /api/v1/updates
+type UpdateCheck struct {
+	PluginID         *uint  `json:"plugin_id"`         // ID of the plugin. Either this or the name is required
+	Name             string `json:"name"`              // Name of the plugin. Only used if no ID is given
+	InstalledVersion string `json:"installed_version"` // The version that is installed
+	AiScriptVersion  string `json:"aiscript_version"`  // AiScript version of the instance. Any if empty
+	MisskeyVersion   string `json:"misskey_version"`   // Misskey version of the instance. Only used if no AiScript version is given
+}
+
+// Result for one UpdateCheck, in the same order as they were sent
+type UpdateInfo struct {
+	PluginID         uint   `json:"plugin_id,omitempty"` // ID of the plugin. Not set if it wasn't found
+	InstalledVersion string `json:"installed_version"`   // The installed version, as sent
+	Error            string `json:"error,omitempty"`     // One of the UPDATE_ERROR_ constants if the check failed
+	// Whether the installed version was yanked, see YankInfo
+	InstalledYanked bool `json:"installed_yanked"`
+	// Whether the newest compatible version is newer than the installed one
+	UpdateAvailable bool `json:"update_available"`
+	// The newest version in the channel of the installed one that runs on the AiScript version
+	LatestVersion   string `json:"latest_version,omitempty"`
+	AiScriptVersion string `json:"aiscript_version,omitempty"` // The AiScript version the newest version targets
+	Changelog       string `json:"changelog"`                  // Changelog of the newest version
+	RiskLevel       string `json:"risk_level,omitempty"`       // How risky the permissions of the newest version are
+	// Whether the newest version requests other permissions than the installed one
+	PermissionsChanged bool     `json:"permissions_changed"`
+	AddedPermissions   []string `json:"added_permissions"`   // Permissions only the newest version requests
+	RemovedPermissions []string `json:"removed_permissions"` // Permissions only the installed version requests
+}
+
+// POST /api/v1/updates
+// Check installed plugins for newer versions
+// Body must be a json array of UpdateCheck, with at most MAX_UPDATE_CHECKS entries
+// Returns a json array of UpdateInfo, one for each check in the same order.
+// Checks that fail have their error set instead of failing the whole request
+func checkUpdates(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("checkUpdates: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	checks := []UpdateCheck{}
+	if !decodeBody(w, r, &checks, maxBodySize(false)) {
+		return
+	}
+	if len(checks) > MAX_UPDATE_CHECKS {
+		writeRequestError(w, &ApiError{
+			Error:   REQUEST_ERROR_INVALID_FIELD,
+			Message: fmt.Sprintf("at most %d plugins can be checked at once", MAX_UPDATE_CHECKS),
+		})
+		return
+	}
+
+	acc := AccountFromRequest(r)
+	infos := make([]UpdateInfo, 0, len(checks))
+	for _, check := range checks {
+		info, err := checkUpdate(store, acc, &check)
+		if err != nil {
+			logrus.WithError(err).WithField("check", check).Errorln("Failed to check for update")
+			writeError(w, "failed to check for updates", http.StatusInternalServerError)
+			return
+		}
+		infos = append(infos, *info)
+	}
+	jbody, err := json.Marshal(infos)
+	if err != nil {
+		logrus.WithError(err).Errorln("checkUpdates: Failed to marshal update infos")
+		writeError(w, "json encoding failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jbody)
+}
+
+// Find the newest version for one installed plugin
+// Problems with the check itself are returned as error in the UpdateInfo, only storage problems as error
+func checkUpdate(store *storage.Storage, acc *storage.Account, check *UpdateCheck) (*UpdateInfo, error) {
+	info := UpdateInfo{
+		InstalledVersion:   check.InstalledVersion,
+		AddedPermissions:   []string{},
+		RemovedPermissions: []string{},
+	}
+	if check.InstalledVersion == "" || (check.PluginID == nil && check.Name == "") {
+		info.Error = UPDATE_ERROR_INVALID_CHECK
+		return &info, nil
+	}
+
+	var plugin *storage.Plugin
+	if check.PluginID != nil {
+		found, err := store.GetPluginByID(*check.PluginID)
+		if errors.Is(err, storage.ErrPluginNotFound) || (err == nil && !found.VisibleTo(acc)) {
+			info.Error = UPDATE_ERROR_NOT_FOUND
+			return &info, nil
+		} else if err != nil {
+			return nil, err
+		}
+		plugin = found
+	} else {
+		found, err := store.FindPluginsByName(check.Name, acc)
+		if err != nil {
+			return nil, err
+		}
+		switch len(found) {
+		case 0:
+			info.Error = UPDATE_ERROR_NOT_FOUND
+			return &info, nil
+		case 1:
+			plugin = &found[0]
+		default:
+			info.Error = UPDATE_ERROR_AMBIGUOUS_NAME
+			return &info, nil
+		}
+	}
+	info.PluginID = plugin.ID
+
+	runtime := check.AiScriptVersion
+	if runtime != "" && !aiscript.IsVersion(runtime) {
+		info.Error = UPDATE_ERROR_BAD_RUNTIME
+		return &info, nil
+	}
+	if runtime == "" && check.MisskeyVersion != "" {
+		var ok bool
+		if runtime, ok = aiscript.ForMisskey(check.MisskeyVersion); !ok {
+			info.Error = UPDATE_ERROR_BAD_RUNTIME
+			return &info, nil
+		}
+	}
+
+	// Unknown installed versions are compared against no permissions at all
+	installedPermissions := []string{}
+	installed, err := store.TryFindVersion(plugin.ID, check.InstalledVersion)
+	if err == nil {
+		installedPermissions = installed.Permissions
+		info.InstalledYanked = installed.Yanked
+	} else if !errors.Is(err, storage.ErrVersionNotFound) {
+		return nil, err
+	}
+
+	latest, err := store.NewestCompatibleVersion(
+		plugin,
+		storage.ChannelOf(check.InstalledVersion),
+		runtime,
+	)
+	if errors.Is(err, storage.ErrNoCompatibleVersion) || errors.Is(err, storage.ErrNoVersionInChannel) {
+		info.Error = UPDATE_ERROR_NO_VERSION
+		return &info, nil
+	} else if err != nil {
+		return nil, err
+	}
+	info.LatestVersion = latest.Version
+	info.AiScriptVersion = latest.AiScriptVersion
+	info.Changelog = latest.Changelog
+	info.RiskLevel = latest.RiskLevel
+	info.UpdateAvailable = storage.CompareVersionNames(latest.Version, check.InstalledVersion) > 0
+	info.AddedPermissions, info.RemovedPermissions = aiscript.DiffPermissions(
+		installedPermissions,
+		latest.Permissions,
+	)
+	info.PermissionsChanged = len(info.AddedPermissions) > 0 || len(info.RemovedPermissions) > 0
+	return &info, nil
+}
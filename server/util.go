@@ -1,10 +1,21 @@
 package server
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
 
+	"github.com/sirupsen/logrus"
 	"github.com/volatiletech/authboss/v3"
+	"gitlab.com/mstarongitlab/goutils/sliceutils"
 
+	"github.com/mstarongithub/mk-plugin-repo/aiscript"
+	"github.com/mstarongithub/mk-plugin-repo/auth"
+	"github.com/mstarongithub/mk-plugin-repo/config"
 	"github.com/mstarongithub/mk-plugin-repo/storage"
 	customtypes "github.com/mstarongithub/mk-plugin-repo/storage/customTypes"
 )
@@ -15,6 +26,12 @@ const (
 	PLUGIN_TYPE_INVALID = "invalid"
 )
 
+const (
+	APPROVAL_STATUS_PENDING  = "pending"
+	APPROVAL_STATUS_APPROVED = "approved"
+	APPROVAL_STATUS_REJECTED = "rejected"
+)
+
 func StorageFromRequest(r *http.Request) *storage.Storage {
 	store, ok := r.Context().Value(CONTEXT_KEY_STORAGE).(*storage.Storage)
 	if !ok {
@@ -39,16 +56,186 @@ func AuthbossFromRequest(r *http.Request) *authboss.Authboss {
 	return store
 }
 
+func AuthFromRequest(r *http.Request) *auth.AuthManager {
+	store, ok := r.Context().Value(CONTEXT_KEY_AUTH).(*auth.AuthManager)
+	if !ok {
+		store = nil
+	}
+	return store
+}
+
+// Get the account the request is authenticated as. Nil if not authenticated
+func AccountFromRequest(r *http.Request) *storage.Account {
+	return auth.AccountFromRequest(r)
+}
+
+// Check that the request's account may manage the plugin with the given ID
+// Writes 401, 403 or 404 to the response and returns false if it may not
+func checkPluginManagementRights(
+	w http.ResponseWriter,
+	r *http.Request,
+	store *storage.Storage,
+	pluginID uint,
+) bool {
+	acc := AccountFromRequest(r)
+	if acc == nil {
+		writeError(w, "not logged in", http.StatusUnauthorized)
+		return false
+	}
+	plugin, err := store.GetPluginByID(pluginID)
+	if err != nil {
+		if errors.Is(err, storage.ErrPluginNotFound) {
+			writeError(w, "plugin not found", http.StatusNotFound)
+		} else {
+			logrus.WithError(err).WithField("pluginID", pluginID).Errorln("Failed to get plugin")
+			writeError(w, "problem getting plugin from storage layer", http.StatusInternalServerError)
+		}
+		return false
+	}
+	if !plugin.CanBeManagedBy(acc) {
+		logrus.WithFields(logrus.Fields{
+			"pluginID":  pluginID,
+			"accountID": acc.ID,
+		}).Infoln("Account tried to manage plugin it doesn't maintain")
+		writeError(w, "you're not a maintainer of the plugin", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// Get the "page" and "per_page" parameters from a query. Both are 0 if not set
+// Writes 400 to the response and returns false if either isn't a positive number
+func pagingFromQuery(w http.ResponseWriter, query url.Values) (int, int, bool) {
+	page, perPage := 0, 0
+	if pageString := query.Get("page"); pageString != "" {
+		pageNr, err := strconv.Atoi(pageString)
+		if err != nil || pageNr < 1 {
+			writeError(w, "page must be a number greater than 0", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		page = pageNr
+	}
+	if perPageString := query.Get("per_page"); perPageString != "" {
+		perPageNr, err := strconv.Atoi(perPageString)
+		if err != nil || perPageNr < 1 {
+			writeError(w, "per_page must be a number greater than 0", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		perPage = perPageNr
+	}
+	return page, perPage, true
+}
+
+// Get the "channel" parameter from a query. Nil if not set
+// Writes 400 to the response and returns false if it isn't a known channel
+func channelFromQuery(w http.ResponseWriter, query url.Values) (*storage.Channel, bool) {
+	channelString := query.Get("channel")
+	if channelString == "" {
+		return nil, true
+	}
+	if !storage.IsChannel(channelString) {
+		writeError(w, `channel must be one of "stable", "beta" or "prerelease"`, http.StatusBadRequest)
+		return nil, false
+	}
+	channel := storage.Channel(channelString)
+	return &channel, true
+}
+
+// Absolute url of a path on this server, based on the configured root url
+func publicUrl(path string) string {
+	root := "localhost:8080"
+	if config.GlobalConfig != nil && config.GlobalConfig.General.RootUrl != "" {
+		root = config.GlobalConfig.General.RootUrl
+	}
+	if !strings.Contains(root, "://") {
+		root = "http://" + root
+	}
+	return strings.TrimSuffix(root, "/") + path
+}
+
+// Name of the file the raw code of a version is downloaded as, like "my-plugin-1.2.0.is"
+// Anything but letters and digits in the plugin's name becomes a dash
+func rawCodeFilename(plugin *storage.Plugin, version *storage.PluginVersion) string {
+	name := strings.Join(strings.FieldsFunc(plugin.Name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), "-")
+	if name == "" {
+		name = fmt.Sprintf("plugin-%d", plugin.ID)
+	}
+	return fmt.Sprintf("%s-%s.is", name, version.Version)
+}
+
+// Get the AiScript version to filter for from the "aiscript_version" or "misskey_version" parameter of a query
+// The latter is turned into the AiScript version that Misskey version ships. Empty if neither is set
+// Writes 400 to the response and returns false if the version isn't valid or known, or both are set
+func aiscriptVersionFromQuery(w http.ResponseWriter, query url.Values) (string, bool) {
+	aiscriptVersion, misskeyVersion := query.Get("aiscript_version"), query.Get("misskey_version")
+	switch {
+	case aiscriptVersion != "" && misskeyVersion != "":
+		writeError(w, "only one of aiscript_version and misskey_version may be set", http.StatusBadRequest)
+		return "", false
+	case aiscriptVersion != "":
+		if !aiscript.IsVersion(aiscriptVersion) {
+			writeError(w, `aiscript_version must be a version like "0.19.0"`, http.StatusBadRequest)
+			return "", false
+		}
+		return aiscriptVersion, true
+	case misskeyVersion != "":
+		version, ok := aiscript.ForMisskey(misskeyVersion)
+		if !ok {
+			writeError(w, "no known AiScript release ships with that misskey_version", http.StatusBadRequest)
+			return "", false
+		}
+		return version, true
+	default:
+		return "", true
+	}
+}
+
+// Get a list from a query parameter. Entries are separated by commas or semicolons
+// Returns nil if the parameter isn't set
+func listFromQuery(query url.Values, key string) []string {
+	value := query.Get(key)
+	if value == "" {
+		return nil
+	}
+	entries := strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ',' })
+	return sliceutils.Filter(
+		sliceutils.Map(entries, strings.TrimSpace),
+		func(entry string) bool { return entry != "" },
+	)
+}
+
+// Amount of pages needed for the given amount of entries. At least 1
+func pageCount(total int64, pageSize int) int {
+	size := int64(pageSize)
+	return max(int((total+size-1)/size), 1)
+}
+
 func dbPluginToApiPlugin(plugin *storage.Plugin) Plugin {
 	newPlugin := Plugin{
-		ID:             plugin.Model.ID,
-		Name:           plugin.Name,
-		SummaryShort:   plugin.SummaryShort,
-		SummaryLong:    plugin.SummaryLong,
-		CurrentVersion: plugin.CurrentVersion,
-		AllVersions:    plugin.PreviousVersions,
-		Tags:           plugin.Tags,
-		AuthorID:       plugin.AuthorID,
+		ID:              plugin.Model.ID,
+		Name:            plugin.Name,
+		SummaryShort:    plugin.SummaryShort,
+		SummaryLong:     plugin.SummaryLong,
+		CurrentVersion:  plugin.CurrentVersion,
+		CurrentVersions: plugin.CurrentVersions,
+		AllVersions:     storage.SortVersionNames(plugin.PreviousVersions),
+		Tags:            plugin.Tags,
+		AuthorID:        plugin.AuthorID,
+		Maintainers:     plugin.Maintainers,
+		Downloads:       plugin.Downloads,
+		Permissions:     plugin.Permissions,
+		RiskLevel:       plugin.RiskLevel,
+	}
+	switch {
+	case plugin.Approved:
+		newPlugin.ApprovalStatus = APPROVAL_STATUS_APPROVED
+	case plugin.Rejected:
+		newPlugin.ApprovalStatus = APPROVAL_STATUS_REJECTED
+		newPlugin.RejectionReason = plugin.RejectionReason
+	default:
+		newPlugin.ApprovalStatus = APPROVAL_STATUS_PENDING
 	}
 	switch plugin.Type {
 	case customtypes.PLUGIN_TYPE_PLUGIN:
@@ -60,3 +247,95 @@ func dbPluginToApiPlugin(plugin *storage.Plugin) Plugin {
 	}
 	return newPlugin
 }
+
+func dbVersionToYankInfo(version *storage.PluginVersion) YankInfo {
+	return YankInfo{
+		Yanked:     version.Yanked,
+		YankReason: version.YankReason,
+		YankedAt:   version.YankedAt,
+	}
+}
+
+func dbVersionToPermissionChanges(version *storage.PluginVersion) PermissionChanges {
+	changes := PermissionChanges{
+		AddedPermissions:   version.AddedPermissions,
+		RemovedPermissions: version.RemovedPermissions,
+		HeldForReview:      version.HeldForReview,
+	}
+	if changes.AddedPermissions == nil {
+		changes.AddedPermissions = []string{}
+	}
+	if changes.RemovedPermissions == nil {
+		changes.RemovedPermissions = []string{}
+	}
+	return changes
+}
+
+func dbVersionToSignatureInfo(version *storage.PluginVersion) SignatureInfo {
+	if len(version.Signature) == 0 {
+		return SignatureInfo{}
+	}
+	return SignatureInfo{
+		SignedBy:       &version.SignedByID,
+		KeyFingerprint: version.SigningKeyFingerprint,
+		Signature:      version.Signature,
+	}
+}
+
+func dbAccountToAccountInfo(acc *storage.Account) AccountInfo {
+	info := AccountInfo{
+		ID:                acc.ID,
+		Name:              acc.Name,
+		Description:       acc.Description,
+		Approved:          acc.Approved,
+		CanApprovePlugins: acc.CanApprovePlugins,
+		CanApproveUsers:   acc.CanApproveUsers,
+		ReviewedAt:        acc.ReviewedAt,
+	}
+	switch {
+	case acc.Approved:
+		info.ApprovalStatus = APPROVAL_STATUS_APPROVED
+	case acc.Rejected:
+		info.ApprovalStatus = APPROVAL_STATUS_REJECTED
+	default:
+		info.ApprovalStatus = APPROVAL_STATUS_PENDING
+	}
+	if acc.ReviewedByID != 0 {
+		info.ReviewedByID = &acc.ReviewedByID
+	}
+	return info
+}
+
+func dbAccessTokenToAccessTokenInfo(token *storage.AccessToken) AccessTokenInfo {
+	return AccessTokenInfo{
+		ID:        token.ID,
+		Name:      token.Name,
+		Scopes:    token.Scopes,
+		CreatedAt: token.CreatedAt,
+		ExpiresAt: token.ExpiresAt,
+		LastUsed:  token.LastUsed,
+	}
+}
+
+func dbSigningKeyToSigningKeyInfo(key *storage.SigningKey) SigningKeyInfo {
+	return SigningKeyInfo{
+		ID:          key.ID,
+		AccountID:   key.AccountID,
+		Name:        key.Name,
+		PublicKey:   key.PublicKey,
+		Fingerprint: key.Fingerprint,
+		CreatedAt:   key.CreatedAt,
+		RevokedAt:   key.RevokedAt(),
+	}
+}
+
+// Remembers the status code written, so that handlers can act on it after serving a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
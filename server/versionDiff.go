@@ -0,0 +1,177 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/mstarongithub/mk-plugin-repo/aiscript"
+	"github.com/mstarongithub/mk-plugin-repo/diff"
+	"github.com/mstarongithub/mk-plugin-repo/storage"
+)
+
+// Returned from GET /api/v1/plugins/{pluginId}/diff
+type VersionDiff struct {
+	From     string       `json:"from"`     // Name of the version to compare from
+	To       string       `json:"to"`       // Name of the version to compare to
+	Code     string       `json:"code"`     // Unified diff of the code. Empty if the code is the same
+	Metadata MetadataDiff `json:"metadata"` // Differences in the parsed metadata
+}
+
+// Differences in the metadata of two versions
+type MetadataDiff struct {
+	AiScriptVersion *ValueChange `json:"aiscript_version,omitempty"` // Nil if unchanged
+	RiskLevel       *ValueChange `json:"risk_level,omitempty"`       // Nil if unchanged
+	Name            *ValueChange `json:"name,omitempty"`             // Nil if unchanged
+	Author          *ValueChange `json:"author,omitempty"`           // Nil if unchanged
+	Description     *ValueChange `json:"description,omitempty"`      // Nil if unchanged
+	Permissions     ListChange   `json:"permissions"`
+	ConfigKeys      ConfigChange `json:"config_keys"`
+}
+
+// A value that differs between two versions
+type ValueChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Entries added to and removed from a list between two versions
+type ListChange struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// Changes to the declared settings between two versions
+type ConfigChange struct {
+	ListChange
+	Changed []string `json:"changed"` // Keys in both versions whose definition differs
+}
+
+// GET /api/v1/plugins/{pluginId}/diff?from={versionName}&to={versionName}
+// Compare two versions of a plugin
+// Returns a json formatted VersionDiff with a unified diff of the code and the differences in the metadata
+func getVersionDiff(w http.ResponseWriter, r *http.Request) {
+	store := StorageFromRequest(r)
+	if store == nil {
+		logrus.Errorln("getVersionDiff: Failed to get storage from request context")
+		writeError(w, "failed to get storage layer from request context", http.StatusInternalServerError)
+		return
+	}
+	pluginID, err := strconv.ParseUint(r.PathValue("pluginId"), 10, 0)
+	if err != nil {
+		writeError(w, "bad plugin id. Must be a uint", http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	fromName, toName := query.Get("from"), query.Get("to")
+	if fromName == "" || toName == "" {
+		writeError(w, "both from and to must be set", http.StatusBadRequest)
+		return
+	}
+
+	acc := AccountFromRequest(r)
+	plugin, err := store.GetPluginByID(uint(pluginID))
+	if err != nil || !plugin.VisibleTo(acc) {
+		if err != nil && !errors.Is(err, storage.ErrPluginNotFound) {
+			logrus.WithError(err).WithField("pluginId", pluginID).Errorln("Problem getting plugin")
+			writeError(w, "error getting plugin from storage layer", http.StatusInternalServerError)
+		} else {
+			writeError(w, "plugin not found", http.StatusNotFound)
+		}
+		return
+	}
+	versions := [2]*storage.PluginVersion{}
+	for i, name := range []string{fromName, toName} {
+		versions[i], err = store.TryFindVersion(plugin.ID, name)
+		// Versions held for review don't exist for anyone but the plugin's maintainers and moderators
+		if err == nil && versions[i].HeldForReview && !plugin.CanBeManagedBy(acc) {
+			err = storage.ErrVersionNotFound
+		}
+		if errors.Is(err, storage.ErrVersionNotFound) {
+			writeError(w, fmt.Sprintf("version %q not found", name), http.StatusNotFound)
+			return
+		} else if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"pluginId":    pluginID,
+				"versionName": name,
+			}).Errorln("Problem getting version for plugin")
+			writeError(w, "error getting version from storage layer", http.StatusInternalServerError)
+			return
+		}
+	}
+	from, to := versions[0], versions[1]
+
+	added, removed := aiscript.DiffPermissions(from.Permissions, to.Permissions)
+	result := VersionDiff{
+		From: from.Version,
+		To:   to.Version,
+		Code: diff.Unified(from.Version, to.Version, from.Code, to.Code, diff.DEFAULT_CONTEXT),
+		Metadata: MetadataDiff{
+			AiScriptVersion: valueChange(from.AiScriptVersion, to.AiScriptVersion),
+			RiskLevel:       valueChange(from.RiskLevel, to.RiskLevel),
+			Name:            valueChange(from.DeclaredName, to.DeclaredName),
+			Author:          valueChange(from.DeclaredAuthor, to.DeclaredAuthor),
+			Description:     valueChange(from.DeclaredDescription, to.DeclaredDescription),
+			Permissions:     ListChange{Added: added, Removed: removed},
+			ConfigKeys:      diffConfigKeys(from.ConfigFields, to.ConfigFields),
+		},
+	}
+	jbody, err := json.Marshal(&result)
+	if err != nil {
+		logrus.WithError(err).WithField("pluginId", pluginID).Errorln("Failed to marshal version diff")
+		writeError(w, "json marshalling failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jbody)
+}
+
+// Nil if both values are the same
+func valueChange(from, to string) *ValueChange {
+	if from == to {
+		return nil
+	}
+	return &ValueChange{From: from, To: to}
+}
+
+// Compare the settings two versions declare by key
+func diffConfigKeys(from, to []aiscript.ConfigField) ConfigChange {
+	change := ConfigChange{
+		ListChange: ListChange{Added: []string{}, Removed: []string{}},
+		Changed:    []string{},
+	}
+	fromFields := configFieldsByKey(from)
+	toFields := configFieldsByKey(to)
+	for key, field := range toFields {
+		previous, ok := fromFields[key]
+		switch {
+		case !ok:
+			change.Added = append(change.Added, key)
+		case !reflect.DeepEqual(previous, field):
+			change.Changed = append(change.Changed, key)
+		}
+	}
+	for key := range fromFields {
+		if _, ok := toFields[key]; !ok {
+			change.Removed = append(change.Removed, key)
+		}
+	}
+	slices.Sort(change.Added)
+	slices.Sort(change.Removed)
+	slices.Sort(change.Changed)
+	return change
+}
+
+func configFieldsByKey(fields []aiscript.ConfigField) map[string]aiscript.ConfigField {
+	byKey := make(map[string]aiscript.ConfigField, len(fields))
+	for _, field := range fields {
+		byKey[field.Key] = field
+	}
+	return byKey
+}
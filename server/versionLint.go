@@ -0,0 +1,47 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/mstarongithub/mk-plugin-repo/aiscript"
+)
+
+// Returned from GET /api/v1/plugins/{pluginId}/{versionName}/lint
+type LintReport struct {
+	VersionName string `json:"version_name"` // Name of the linted version
+	// Severity of the most severe finding. One of "info", "warning" and "danger". Empty if nothing was found
+	HighestSeverity string             `json:"highest_severity,omitempty"`
+	Findings        []aiscript.Finding `json:"findings"` // What the linter found, ordered by position
+}
+
+// GET /api/v1/plugins/{pluginId}/{versionName}/lint
+// Get what the linter found in the code of a version when it was uploaded
+// Returns a json formatted LintReport
+func getVersionLint(w http.ResponseWriter, r *http.Request) {
+	_, _, version, ok := versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+	findings := version.LintFindings
+	if findings == nil {
+		findings = []aiscript.Finding{}
+	}
+	jbody, err := json.Marshal(&LintReport{
+		VersionName:     version.Version,
+		HighestSeverity: string(aiscript.HighestSeverity(findings)),
+		Findings:        findings,
+	})
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"pluginId":    version.PluginID,
+			"versionName": version.Version,
+		}).Errorln("Failed to marshal lint report")
+		writeError(w, "json marshalling failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jbody)
+}
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/mstarongithub/mk-plugin-repo/util"
+)
+
+// Prefix of every personal access token. Makes them distinguishable from session tokens
+const ACCESS_TOKEN_PREFIX = "mkpr_"
+
+// Length in bytes of the random secret part of an access token
+const ACCESS_TOKEN_SECRET_LENGTH = 32
+
+const (
+	TOKEN_SCOPE_PLUGINS_WRITE    = "plugins:write"    // Create, update and delete plugins
+	TOKEN_SCOPE_VERSIONS_PUBLISH = "versions:publish" // Publish and yank versions of plugins
+)
+
+// All scopes an access token can be granted
+var ValidTokenScopes = []string{
+	TOKEN_SCOPE_PLUGINS_WRITE,
+	TOKEN_SCOPE_VERSIONS_PUBLISH,
+}
+
+// A personal access token, used for non-interactive access to the API (CI for example)
+// Only a hash of the secret is stored. The full token is only known at creation time
+type AccessToken struct {
+	gorm.Model
+	AccountID uint       // The account this token acts as
+	Name      string     // A name given by the owner to identify the token
+	Scopes    []string   `gorm:"serializer:json"` // What the token is allowed to do
+	ExpiresAt *time.Time // When the token expires. Never if nil
+	LastUsed  *time.Time // When the token was last used to authenticate a request
+	Hash      []byte     // Argon2 hash of the secret part of the token
+	Salt      []byte     // Salt used for hashing the secret
+}
+
+var ErrInvalidAccessToken = errors.New("invalid, expired or revoked access token")
+var ErrInvalidScope = errors.New("invalid token scope")
+var ErrAccessTokenNotFound = errors.New("access token not found")
+
+// Whether the token has the given scope
+func (t *AccessToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// Create a new access token for an account
+// Returns the stored token and the full token string. The latter can't be recovered later
+func (storage *Storage) NewAccessToken(
+	accountID uint,
+	name string,
+	scopes []string,
+	expiresAt *time.Time,
+) (*AccessToken, string, error) {
+	for _, scope := range scopes {
+		if !slices.Contains(ValidTokenScopes, scope) {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+	if _, err := storage.FindAccountByID(accountID); err != nil {
+		return nil, "", err
+	}
+
+	rawSecret := make([]byte, ACCESS_TOKEN_SECRET_LENGTH)
+	if _, err := rand.Read(rawSecret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate token secret: %w", err)
+	}
+	secret := hex.EncodeToString(rawSecret)
+	hash, salt, err := util.Hash(secret, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to hash token secret: %w", err)
+	}
+
+	sortedScopes := slices.Clone(scopes)
+	slices.Sort(sortedScopes)
+	token := AccessToken{
+		AccountID: accountID,
+		Name:      name,
+		Scopes:    slices.Compact(sortedScopes),
+		ExpiresAt: expiresAt,
+		Hash:      hash,
+		Salt:      salt,
+	}
+	res := storage.db.Create(&token)
+	if res.Error != nil {
+		return nil, "", fmt.Errorf("failed to insert access token: %w", res.Error)
+	}
+	logrus.WithFields(logrus.Fields{
+		"accountID": accountID,
+		"tokenID":   token.ID,
+		"scopes":    token.Scopes,
+	}).Infoln("Created new access token")
+
+	// The ID is part of the token so that the matching hash can be looked up
+	return &token, fmt.Sprintf("%s%d_%s", ACCESS_TOKEN_PREFIX, token.ID, secret), nil
+}
+
+// Get all access tokens an account has. Revoked tokens are not included
+func (storage *Storage) GetAccessTokensFor(accountID uint) ([]AccessToken, error) {
+	tokens := []AccessToken{}
+	res := storage.db.Where("account_id = ?", accountID).Order("id").Find(&tokens)
+	if res.Error != nil {
+		return nil, fmt.Errorf("failed to get access tokens of account %d: %w", accountID, res.Error)
+	}
+	return tokens, nil
+}
+
+// Revoke an access token of an account
+// Returns ErrAccessTokenNotFound if the account has no token with that ID
+func (storage *Storage) RevokeAccessToken(accountID, tokenID uint) error {
+	res := storage.db.Where("account_id = ?", accountID).Delete(&AccessToken{}, tokenID)
+	if res.Error != nil {
+		return fmt.Errorf("failed to revoke access token %d: %w", tokenID, res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrAccessTokenNotFound
+	}
+	logrus.WithFields(logrus.Fields{
+		"accountID": accountID,
+		"tokenID":   tokenID,
+	}).Infoln("Revoked access token")
+	return nil
+}
+
+// Get the account and token entry for a full access token string
+// Returns ErrInvalidAccessToken if the token is malformed, unknown, revoked or expired
+func (storage *Storage) AccountFromAccessToken(tokenString string) (*Account, *AccessToken, error) {
+	rest, found := strings.CutPrefix(tokenString, ACCESS_TOKEN_PREFIX)
+	if !found {
+		return nil, nil, ErrInvalidAccessToken
+	}
+	idString, secret, found := strings.Cut(rest, "_")
+	if !found {
+		return nil, nil, ErrInvalidAccessToken
+	}
+	tokenID, err := strconv.ParseUint(idString, 10, 0)
+	if err != nil {
+		return nil, nil, ErrInvalidAccessToken
+	}
+
+	token := AccessToken{}
+	res := storage.db.First(&token, uint(tokenID))
+	if res.RowsAffected == 0 {
+		return nil, nil, ErrInvalidAccessToken
+	} else if res.Error != nil {
+		return nil, nil, fmt.Errorf("failed to get access token %d: %w", tokenID, res.Error)
+	}
+	hash, _, err := util.Hash(secret, token.Salt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to hash token secret: %w", err)
+	}
+	if subtle.ConstantTimeCompare(hash, token.Hash) != 1 {
+		logrus.WithField("tokenID", tokenID).Infoln("Access token with wrong secret used")
+		return nil, nil, ErrInvalidAccessToken
+	}
+	now := time.Now()
+	if token.ExpiresAt != nil && token.ExpiresAt.Before(now) {
+		return nil, nil, ErrInvalidAccessToken
+	}
+
+	acc, err := storage.FindAccountByID(token.AccountID)
+	if err != nil {
+		if errors.Is(err, ErrAccountNotFound) {
+			return nil, nil, ErrInvalidAccessToken
+		}
+		return nil, nil, err
+	}
+	token.LastUsed = &now
+	if res = storage.db.Model(&token).Update("last_used", now); res.Error != nil {
+		logrus.WithError(res.Error).
+			WithField("tokenID", tokenID).
+			Warnln("Failed to update last use of access token")
+	}
+	return acc, &token, nil
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Release channel of a plugin version, derived from the prerelease suffix of its name
+type Channel string
+
+const (
+	CHANNEL_STABLE     Channel = "stable"     // Versions without prerelease suffix, like 1.2.3
+	CHANNEL_BETA       Channel = "beta"       // Versions like 1.2.3-beta.1 or 1.2.3-rc.1
+	CHANNEL_PRERELEASE Channel = "prerelease" // Any other prerelease, like 1.2.3-alpha or 1.2.3-dev.4
+)
+
+// All channels, from most to least stable
+// Each channel also includes the versions of all channels before it
+var Channels = []Channel{
+	CHANNEL_STABLE,
+	CHANNEL_BETA,
+	CHANNEL_PRERELEASE,
+}
+
+// Prerelease identifiers putting a version into the beta channel
+var betaIdentifiers = []string{"beta", "rc"}
+
+var ErrNoVersionInChannel = errors.New("plugin has no version in this channel")
+
+// Whether the string is a known channel
+func IsChannel(channel string) bool {
+	return slices.Contains(Channels, Channel(channel))
+}
+
+// Whether this channel includes the versions of the other one
+func (channel Channel) Includes(other Channel) bool {
+	return slices.Index(Channels, other) <= slices.Index(Channels, channel)
+}
+
+// Get the channel of a version by its name
+// Names that aren't semantic versions are considered stable
+func ChannelOf(versionName string) Channel {
+	version, err := ParseSemver(versionName)
+	if err != nil || version.IsStable() {
+		return CHANNEL_STABLE
+	}
+	if slices.Contains(betaIdentifiers, strings.ToLower(version.Prerelease[0])) {
+		return CHANNEL_BETA
+	}
+	return CHANNEL_PRERELEASE
+}
+
+// Get the current version of each channel out of the given ones: the one with the highest precedence
+// the channel includes. Channels without any version are left out
+// Of equally ranked versions, the one listed last wins
+func pickChannelVersions(names []string) map[Channel]string {
+	current := map[Channel]string{}
+	for _, name := range names {
+		nameChannel := ChannelOf(name)
+		for _, channel := range Channels {
+			if !channel.Includes(nameChannel) {
+				continue
+			}
+			if best, ok := current[channel]; !ok || CompareVersionNames(name, best) >= 0 {
+				current[channel] = name
+			}
+		}
+	}
+	return current
+}
+
+// The current version of the most stable channel that has one. Empty if there is no version at all
+func defaultCurrentVersion(current map[Channel]string) string {
+	for _, channel := range Channels {
+		if name, ok := current[channel]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// Switch the plugin over to the current version of the given channel
+// Updates CurrentVersion, Permissions and RiskLevel. Nothing is saved
+// Returns ErrNoVersionInChannel if the channel has no version of the plugin
+func (storage *Storage) PluginInChannel(plugin *Plugin, channel Channel) error {
+	name, ok := plugin.CurrentVersions[channel]
+	if !ok {
+		return ErrNoVersionInChannel
+	}
+	if name == plugin.CurrentVersion {
+		return nil
+	}
+	version, err := storage.TryFindVersion(plugin.ID, name)
+	if err != nil {
+		return err
+	}
+	plugin.CurrentVersion = name
+	plugin.Permissions = version.Permissions
+	plugin.RiskLevel = version.RiskLevel
+	return nil
+}
+
+// Fill in the channels of versions and plugins from before channels existed
+func backfillChannels(db *gorm.DB) error {
+	versions := []PluginVersion{}
+	res := db.Unscoped().Where("channel IS NULL OR channel = ''").Find(&versions)
+	if res.Error != nil {
+		return fmt.Errorf("failed to get versions without channel: %w", res.Error)
+	}
+	for _, version := range versions {
+		err := db.Exec(
+			"UPDATE plugin_versions SET channel = ? WHERE id = ?",
+			string(ChannelOf(version.Version)),
+			version.ID,
+		).Error
+		if err != nil {
+			return fmt.Errorf("failed to store channel of version %d: %w", version.ID, err)
+		}
+	}
+
+	plugins := []Plugin{}
+	res = db.Unscoped().Where("current_versions IS NULL OR current_versions = ''").Find(&plugins)
+	if res.Error != nil {
+		return fmt.Errorf("failed to get plugins without channel versions: %w", res.Error)
+	}
+	if len(versions) > 0 || len(plugins) > 0 {
+		logrus.WithFields(logrus.Fields{
+			"versions": len(versions),
+			"plugins":  len(plugins),
+		}).Infoln("Assigned release channels to old plugin versions")
+	}
+	for _, plugin := range plugins {
+		current, err := json.Marshal(pickChannelVersions(plugin.PreviousVersions))
+		if err != nil {
+			return fmt.Errorf("failed to encode channel versions: %w", err)
+		}
+		err = db.Exec(
+			"UPDATE plugins SET current_versions = ? WHERE id = ?",
+			string(current),
+			plugin.ID,
+		).Error
+		if err != nil {
+			return fmt.Errorf("failed to store channel versions of plugin %d: %w", plugin.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestChannelOf(t *testing.T) {
+	tests := []struct {
+		name string
+		want Channel
+	}{
+		{"1.2.3", CHANNEL_STABLE},
+		{"1.2.3+build.1", CHANNEL_STABLE},
+		{"1.2.3-beta", CHANNEL_BETA},
+		{"1.2.3-beta.1", CHANNEL_BETA},
+		{"1.2.3-RC.2", CHANNEL_BETA},
+		{"1.2.3-alpha", CHANNEL_PRERELEASE},
+		{"1.2.3-dev.4", CHANNEL_PRERELEASE},
+		{"1.2.3-0.beta", CHANNEL_PRERELEASE},
+		// Names that aren't semantic versions are stable
+		{"latest", CHANNEL_STABLE},
+		{"v2-beta", CHANNEL_STABLE},
+	}
+	for _, test := range tests {
+		if got := ChannelOf(test.name); got != test.want {
+			t.Errorf("ChannelOf(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestChannelIncludes(t *testing.T) {
+	tests := []struct {
+		channel, other Channel
+		want           bool
+	}{
+		{CHANNEL_STABLE, CHANNEL_STABLE, true},
+		{CHANNEL_STABLE, CHANNEL_BETA, false},
+		{CHANNEL_STABLE, CHANNEL_PRERELEASE, false},
+		{CHANNEL_BETA, CHANNEL_STABLE, true},
+		{CHANNEL_BETA, CHANNEL_PRERELEASE, false},
+		{CHANNEL_PRERELEASE, CHANNEL_STABLE, true},
+		{CHANNEL_PRERELEASE, CHANNEL_BETA, true},
+	}
+	for _, test := range tests {
+		if got := test.channel.Includes(test.other); got != test.want {
+			t.Errorf("%q.Includes(%q) = %v, want %v", test.channel, test.other, got, test.want)
+		}
+	}
+}
+
+func TestPickChannelVersions(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		want  map[Channel]string
+	}{
+		{"no versions", []string{}, map[Channel]string{}},
+		{
+			"only stable versions",
+			[]string{"1.0.0", "1.2.0", "1.1.0"},
+			map[Channel]string{CHANNEL_STABLE: "1.2.0", CHANNEL_BETA: "1.2.0", CHANNEL_PRERELEASE: "1.2.0"},
+		},
+		{
+			"prereleases ahead of stable",
+			[]string{"1.0.0", "1.1.0-beta.1", "1.1.0-beta.2", "1.2.0-alpha"},
+			map[Channel]string{CHANNEL_STABLE: "1.0.0", CHANNEL_BETA: "1.1.0-beta.2", CHANNEL_PRERELEASE: "1.2.0-alpha"},
+		},
+		{
+			"stable release supersedes its prereleases",
+			[]string{"1.1.0-alpha", "1.1.0-rc.1", "1.1.0"},
+			map[Channel]string{CHANNEL_STABLE: "1.1.0", CHANNEL_BETA: "1.1.0", CHANNEL_PRERELEASE: "1.1.0"},
+		},
+		{
+			"only prereleases",
+			[]string{"0.1.0-dev.1", "0.1.0-dev.2"},
+			map[Channel]string{CHANNEL_PRERELEASE: "0.1.0-dev.2"},
+		},
+		{
+			"only betas",
+			[]string{"2.0.0-beta.1"},
+			map[Channel]string{CHANNEL_BETA: "2.0.0-beta.1", CHANNEL_PRERELEASE: "2.0.0-beta.1"},
+		},
+		{
+			"semantic versions rank above other names",
+			[]string{"1.0.0", "latest"},
+			map[Channel]string{CHANNEL_STABLE: "1.0.0", CHANNEL_BETA: "1.0.0", CHANNEL_PRERELEASE: "1.0.0"},
+		},
+		{
+			"of equally ranked names the last wins",
+			[]string{"old", "new"},
+			map[Channel]string{CHANNEL_STABLE: "new", CHANNEL_BETA: "new", CHANNEL_PRERELEASE: "new"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := pickChannelVersions(test.names); !maps.Equal(got, test.want) {
+				t.Errorf("pickChannelVersions(%v) = %v, want %v", test.names, got, test.want)
+			}
+		})
+	}
+}
+
+func TestDefaultCurrentVersion(t *testing.T) {
+	tests := []struct {
+		current map[Channel]string
+		want    string
+	}{
+		{map[Channel]string{}, ""},
+		{map[Channel]string{CHANNEL_STABLE: "1.0.0", CHANNEL_BETA: "1.1.0-beta"}, "1.0.0"},
+		{map[Channel]string{CHANNEL_BETA: "1.1.0-beta", CHANNEL_PRERELEASE: "1.2.0-dev"}, "1.1.0-beta"},
+		{map[Channel]string{CHANNEL_PRERELEASE: "1.2.0-dev"}, "1.2.0-dev"},
+	}
+	for _, test := range tests {
+		if got := defaultCurrentVersion(test.current); got != test.want {
+			t.Errorf("defaultCurrentVersion(%v) = %q, want %q", test.current, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// A Misskey instance (or fork) someone requested an install link for
+type Instance struct {
+	gorm.Model
+	Host            string     `gorm:"uniqueIndex"` // Normalised host, like "misskey.example"
+	Software        string     // Software the instance announced via nodeinfo, like "misskey". Empty if unknown
+	SoftwareVersion string     // Version of that software
+	CheckedAt       *time.Time // When the software was last fetched successfully
+}
+
+// An install link generated for a plugin version and an instance
+// Kept to tell which versions are installed on which software versions
+// Recorded at most once per version, instance and day
+type PluginInstall struct {
+	gorm.Model
+	PluginID        uint   `gorm:"index;index:idx_plugin_install_day"`
+	VersionName     string `gorm:"index:idx_plugin_install_day"` // The version the link installs
+	InstanceID      uint   `gorm:"index:idx_plugin_install_day"` // The instance the link points to
+	Day             string `gorm:"index:idx_plugin_install_day"` // UTC date the link was generated on, like "2024-08-01"
+	Software        string // Software of the instance at the time
+	SoftwareVersion string // Version of that software at the time
+	Method          string // How the plugin gets installed, one of the misskey.INSTALL_METHOD_ constants
+}
+
+var ErrInstanceNotFound = errors.New("instance not found")
+
+// Set the day of installs recorded before it was stored
+func backfillInstallDays(db *gorm.DB) error {
+	res := db.Exec("UPDATE plugin_installs SET day = date(created_at) WHERE day IS NULL OR day = ''")
+	if res.Error != nil {
+		return fmt.Errorf("failed to backfill install days: %w", res.Error)
+	}
+	return nil
+}
+
+// Get a known instance by its normalised host
+func (storage *Storage) GetInstance(host string) (*Instance, error) {
+	instance := Instance{}
+	res := storage.db.Where("host = ?", host).First(&instance)
+	if res.RowsAffected == 0 {
+		return nil, ErrInstanceNotFound
+	} else if res.Error != nil {
+		return nil, fmt.Errorf("failed to get instance %s: %w", host, res.Error)
+	}
+	return &instance, nil
+}
+
+// Remember what software an instance runs. Creates the instance if it isn't known yet
+// Empty software leaves what is known as is, but still makes sure the instance exists
+func (storage *Storage) RecordInstance(host, software, softwareVersion string) (*Instance, error) {
+	instance, err := storage.GetInstance(host)
+	if errors.Is(err, ErrInstanceNotFound) {
+		instance = &Instance{Host: host}
+	} else if err != nil {
+		return nil, err
+	}
+	if software != "" {
+		now := time.Now()
+		if instance.Software != software || instance.SoftwareVersion != softwareVersion {
+			logrus.WithFields(logrus.Fields{
+				"host":     host,
+				"software": software,
+				"version":  softwareVersion,
+			}).Infoln("Recording instance software")
+		}
+		instance.Software = software
+		instance.SoftwareVersion = softwareVersion
+		instance.CheckedAt = &now
+	}
+	if res := storage.db.Save(instance); res.Error != nil {
+		return nil, fmt.Errorf("failed to save instance %s: %w", host, res.Error)
+	}
+	return instance, nil
+}
+
+// Remember that an install link was generated for a version and an instance
+// Links generated again on the same day aren't recorded again
+func (storage *Storage) RecordPluginInstall(version *PluginVersion, instance *Instance, method string) error {
+	install := PluginInstall{}
+	res := storage.db.
+		Where(&PluginInstall{
+			PluginID:    version.PluginID,
+			VersionName: version.Version,
+			InstanceID:  instance.ID,
+			Day:         time.Now().UTC().Format(time.DateOnly),
+		}).
+		Attrs(&PluginInstall{
+			Software:        instance.Software,
+			SoftwareVersion: instance.SoftwareVersion,
+			Method:          method,
+		}).
+		FirstOrCreate(&install)
+	if res.Error != nil {
+		return fmt.Errorf("failed to record install of plugin %d: %w", version.PluginID, res.Error)
+	}
+	return nil
+}
@@ -3,17 +3,21 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 
+	"github.com/mstarongithub/mk-plugin-repo/aiscript"
 	customtypes "github.com/mstarongithub/mk-plugin-repo/storage/customTypes"
 )
 
 // Also used for widgets
 type Plugin struct {
 	gorm.Model
-	CurrentVersion   string                 // The current version string
+	CurrentVersion   string                 // The current version of the most stable channel that has one
+	CurrentVersions  map[Channel]string     `gorm:"serializer:json"` // The current version of each channel that has one
 	PreviousVersions []string               `gorm:"serializer:json"` // List of all previous versions
 	Name             string                 // The name of the plugin
 	SummaryShort     string                 // A short description for this plugin
@@ -22,6 +26,45 @@ type Plugin struct {
 	Tags             []string               `gorm:"serializer:json"` // Tags for this plugin
 	Type             customtypes.PluginType // What type of plugin this is. Normal plugin or widget are the only options currently
 	Approved         bool                   // Got this plugin approved for publishing?
+	Maintainers      []uint                 `gorm:"serializer:json"` // IDs of accounts allowed to manage this plugin besides the author
+	Rejected         bool                   // Did a moderator reject this plugin?
+	RejectionReason  string                 // Why the plugin was rejected. Shown to the author
+	ReviewedByID     uint                   // ID of the moderator who last approved or rejected this plugin
+	ReviewedAt       *time.Time             // When the plugin was last approved or rejected
+	Downloads        uint                   // How often the code of any version of this plugin was fetched
+	Permissions      []string               `gorm:"serializer:json"` // Misskey permissions the current version requests
+	RiskLevel        string                 // How risky the permissions of the current version are
+}
+
+// Condition for plugins visible to everyone
+const sqlPluginPublic = "plugins.approved = 1"
+
+// Condition for plugins an account manages. Takes the account ID twice
+const sqlPluginManagedBy = "plugins.author_id = ? OR EXISTS " +
+	"(SELECT 1 FROM json_each(plugins.maintainers) WHERE json_each.value = ?)"
+
+// Whether the given account is allowed to publish and hide versions and edit the plugin's data
+// That is the author, any co-maintainer and plugin moderators
+func (p *Plugin) CanBeManagedBy(acc *Account) bool {
+	if acc == nil {
+		return false
+	}
+	return p.AuthorID == acc.ID || slices.Contains(p.Maintainers, acc.ID) || acc.CanApprovePlugins
+}
+
+// Whether the given account is allowed to see the plugin
+// Approved plugins are visible to everyone, others only to those who can manage them
+func (p *Plugin) VisibleTo(acc *Account) bool {
+	return p.Approved || p.CanBeManagedBy(acc)
+}
+
+// Whether the given account is allowed to delete the plugin or change its maintainers
+// That is only the author and plugin moderators
+func (p *Plugin) CanBeDeletedBy(acc *Account) bool {
+	if acc == nil {
+		return false
+	}
+	return p.AuthorID == acc.ID || acc.CanApprovePlugins
 }
 
 func (storage *Storage) GetAllPlugins() []Plugin {
@@ -54,6 +97,7 @@ func (storage *Storage) GetPluginByID(pluginID uint) (*Plugin, error) {
 }
 
 // Tell a plugin that a new version has been added
+// The current version becomes the one with the highest precedence, which isn't necessarily the new one
 func (storage *Storage) PushNewPluginVersion(
 	pluginID uint,
 	versionName string,
@@ -62,14 +106,33 @@ func (storage *Storage) PushNewPluginVersion(
 	if err != nil {
 		return nil, err
 	}
-	_, err = storage.TryFindVersion(pluginID, versionName)
-	if err != nil {
+	plugin.PreviousVersions = append(plugin.PreviousVersions, versionName)
+	if err = storage.refreshCurrentVersion(plugin); err != nil {
 		return nil, err
 	}
-	plugin.PreviousVersions = append(plugin.PreviousVersions, versionName)
-	plugin.CurrentVersion = versionName
+	return plugin, nil
+}
+
+// Point the plugin to the highest version of each channel and save it
+func (storage *Storage) refreshCurrentVersion(plugin *Plugin) error {
+	plugin.CurrentVersions = pickChannelVersions(plugin.PreviousVersions)
+	plugin.CurrentVersion = defaultCurrentVersion(plugin.CurrentVersions)
+	plugin.Permissions = nil
+	plugin.RiskLevel = ""
+	if plugin.CurrentVersion != "" {
+		version, err := storage.TryFindVersion(plugin.ID, plugin.CurrentVersion)
+		if err != nil {
+			return err
+		}
+		plugin.Permissions = version.Permissions
+		plugin.RiskLevel = version.RiskLevel
+	}
 	res := storage.db.Save(plugin)
-	return nil, res.Error
+	if res.Error != nil {
+		return res.Error
+	}
+	storage.reindexPlugin(plugin.ID)
+	return nil
 }
 
 func (storage *Storage) NewPlugin(
@@ -82,6 +145,8 @@ func (storage *Storage) NewPlugin(
 	pluginType customtypes.PluginType,
 	code string,
 	aiscriptVersion string,
+	meta *aiscript.Metadata,
+	signature *CodeSignature,
 ) (*Plugin, error) {
 	plugin := Plugin{
 		CurrentVersion:   firstVersion,
@@ -94,6 +159,9 @@ func (storage *Storage) NewPlugin(
 		Type:             pluginType,
 		Approved:         false,
 	}
+	if err := ValidateVersionName(firstVersion); err != nil {
+		return nil, err
+	}
 	// Check that account exists
 	acc, err := storage.FindAccountByID(authorID)
 	if err != nil {
@@ -122,7 +190,7 @@ func (storage *Storage) NewPlugin(
 		return nil, fmt.Errorf("error while creating new plugin (data: %#v) in db: %w", plugin, err)
 	}
 
-	err = storage.NewVersion(plugin.ID, firstVersion, code, aiscriptVersion)
+	_, err = storage.NewVersion(plugin.ID, authorID, firstVersion, code, aiscriptVersion, "", meta, signature)
 	if err != nil {
 		return nil, fmt.Errorf("error while creating first plugin version: %w", err)
 	}
@@ -133,20 +201,41 @@ func (storage *Storage) NewPlugin(
 func (storage *Storage) UpdatePlugin(newPlugin *Plugin) error {
 	// TODO: Add logging
 	res := storage.db.Save(newPlugin)
-	return res.Error
+	if res.Error != nil {
+		return res.Error
+	}
+	storage.reindexPlugin(newPlugin.ID)
+	return nil
 }
 
-func (storage *Storage) DeletePlugin(pluginID, authorID uint) error {
-	// TODO: Add logging
+// Delete a plugin on behalf of the given account
+// Returns ErrUnauthorised if that account isn't allowed to delete the plugin
+func (storage *Storage) DeletePlugin(pluginID uint, by *Account) error {
+	if by == nil {
+		return ErrUnauthorised
+	}
 	plugin, err := storage.GetPluginByID(pluginID)
-	if err != nil && !errors.Is(err, ErrPluginNotFound) {
-		// TODO: Add logging
+	if err != nil {
+		if errors.Is(err, ErrPluginNotFound) {
+			return nil
+		}
 		return err
 	}
-	if plugin.AuthorID != authorID {
-		// TODO: Add logging
+	if !plugin.CanBeDeletedBy(by) {
+		logrus.WithFields(logrus.Fields{
+			"pluginID":  pluginID,
+			"accountID": by.ID,
+		}).Infoln("Account tried to delete plugin it doesn't own")
 		return ErrUnauthorised
 	}
-	storage.db.Delete(plugin)
+	logrus.WithFields(logrus.Fields{
+		"pluginID":  pluginID,
+		"accountID": by.ID,
+	}).Infoln("Deleting plugin")
+	res := storage.db.Delete(plugin)
+	if res.Error != nil {
+		return res.Error
+	}
+	storage.reindexPlugin(pluginID)
 	return nil
 }
@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Name of the FTS5 table indexing plugins. The rowid of each entry is the ID of the plugin
+const pluginIndexTable = "plugin_search"
+
+// Markers the index wraps matches in. Replaced with html after escaping the snippet
+const (
+	snippetMatchStart = "\x02"
+	snippetMatchEnd   = "\x03"
+)
+
+// How many tokens a snippet may be long at most
+const snippetTokens = 24
+
+// A plugin found via full-text search
+type PluginSearchResult struct {
+	Plugin Plugin
+	// Html-escaped excerpt of the best matching field. Matches are wrapped in <mark> tags
+	// Empty if full-text search isn't available
+	Snippet string
+	// How well the plugin matched. Lower is better
+	Rank float64
+}
+
+// Create the full-text index if the sqlite build supports FTS5 and fill it if it's out of date
+// Returns whether full-text search is available
+func setupPluginIndex(db *gorm.DB) (bool, error) {
+	err := db.Exec(
+		"CREATE VIRTUAL TABLE IF NOT EXISTS " + pluginIndexTable +
+			" USING fts5(name, summary_short, summary_long, tags, code)",
+	).Error
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			logrus.Warnln("Sqlite was built without FTS5, falling back to simple search. Build with -tags sqlite_fts5 to enable full-text search")
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to create plugin search index: %w", err)
+	}
+
+	var indexed, plugins int64
+	if err = db.Table(pluginIndexTable).Count(&indexed).Error; err != nil {
+		return false, fmt.Errorf("failed to count indexed plugins: %w", err)
+	}
+	if err = db.Model(&Plugin{}).Count(&plugins).Error; err != nil {
+		return false, fmt.Errorf("failed to count plugins: %w", err)
+	}
+	if indexed == plugins {
+		return true, nil
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"indexed": indexed,
+		"plugins": plugins,
+	}).Infoln("Plugin search index out of date, rebuilding")
+	ids := []uint{}
+	if err = db.Model(&Plugin{}).Pluck("id", &ids).Error; err != nil {
+		return false, fmt.Errorf("failed to get plugin ids: %w", err)
+	}
+	if err = db.Exec("DELETE FROM " + pluginIndexTable).Error; err != nil {
+		return false, fmt.Errorf("failed to clear plugin search index: %w", err)
+	}
+	for _, id := range ids {
+		if err = indexPlugin(db, id); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Update the index entry of a plugin. Removes the entry if the plugin doesn't exist (anymore)
+// Does nothing if full-text search isn't available
+func (storage *Storage) reindexPlugin(pluginID uint) {
+	if !storage.fullTextSearch {
+		return
+	}
+	if err := indexPlugin(storage.db, pluginID); err != nil {
+		logrus.WithError(err).WithField("pluginID", pluginID).Errorln("Failed to update plugin search index")
+	}
+}
+
+func indexPlugin(db *gorm.DB, pluginID uint) error {
+	err := db.Exec("DELETE FROM "+pluginIndexTable+" WHERE rowid = ?", pluginID).Error
+	if err != nil {
+		return fmt.Errorf("failed to remove plugin %d from search index: %w", pluginID, err)
+	}
+	plugin := Plugin{}
+	res := db.Limit(1).Find(&plugin, pluginID)
+	if res.Error != nil {
+		return fmt.Errorf("failed to get plugin %d for indexing: %w", pluginID, res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil
+	}
+	version := PluginVersion{}
+	res = db.Where("plugin_id = ? AND version = ?", pluginID, plugin.CurrentVersion).
+		Limit(1).
+		Find(&version)
+	if res.Error != nil {
+		return fmt.Errorf("failed to get current version of plugin %d for indexing: %w", pluginID, res.Error)
+	}
+	err = db.Exec(
+		"INSERT INTO "+pluginIndexTable+
+			" (rowid, name, summary_short, summary_long, tags, code) VALUES (?, ?, ?, ?, ?, ?)",
+		plugin.ID,
+		plugin.Name,
+		plugin.SummaryShort,
+		plugin.SummaryLong,
+		strings.Join(plugin.Tags, " "),
+		version.Code,
+	).Error
+	if err != nil {
+		return fmt.Errorf("failed to add plugin %d to search index: %w", pluginID, err)
+	}
+	return nil
+}
+
+// Full-text search over the name, summaries, tags and current code of all plugins visible to the given account
+// Results are ranked by relevance, with matches in the name and tags weighing the most
+// Falls back to substring matching without ranking or snippets if full-text search isn't available
+// Returns the results on the requested page and the total amount of matching plugins
+func (storage *Storage) SearchPlugins(
+	text string,
+	visibleTo *Account,
+	page, pageSize int,
+) ([]PluginSearchResult, int64, error) {
+	page = max(page, 1)
+	pageSize = EffectivePageSize(pageSize)
+	if !storage.fullTextSearch {
+		return storage.searchPluginsSimple(text, visibleTo, page, pageSize)
+	}
+	match := ftsQuery(text)
+	if match == "" {
+		return []PluginSearchResult{}, 0, nil
+	}
+
+	query := storage.onlyVisiblePlugins(
+		storage.db.Table(pluginIndexTable).
+			Joins("JOIN plugins ON plugins.id = "+pluginIndexTable+".rowid AND plugins.deleted_at IS NULL").
+			Where(pluginIndexTable+" MATCH ?", match),
+		visibleTo,
+	)
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	hits := []struct {
+		ID      uint
+		Snippet string
+		Rank    float64
+	}{}
+	err := query.Select(
+		"plugins.id AS id, "+
+			"snippet("+pluginIndexTable+", -1, ?, ?, '…', ?) AS snippet, "+
+			"bm25("+pluginIndexTable+", 10.0, 4.0, 2.0, 8.0, 1.0) AS rank",
+		snippetMatchStart,
+		snippetMatchEnd,
+		snippetTokens,
+	).
+		Order("rank").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Scan(&hits).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search plugins: %w", err)
+	}
+
+	results := make([]PluginSearchResult, 0, len(hits))
+	for _, hit := range hits {
+		plugin, err := storage.GetPluginByID(hit.ID)
+		if err != nil {
+			if errors.Is(err, ErrPluginNotFound) {
+				continue
+			}
+			return nil, 0, err
+		}
+		results = append(results, PluginSearchResult{
+			Plugin:  *plugin,
+			Snippet: highlightSnippet(hit.Snippet),
+			Rank:    hit.Rank,
+		})
+	}
+	logrus.WithFields(logrus.Fields{
+		"query": match,
+		"total": total,
+		"found": len(results),
+	}).Debugln("Searched plugin index")
+	return results, total, nil
+}
+
+// Substring search used when sqlite lacks FTS5. Results are ordered by name
+func (storage *Storage) searchPluginsSimple(
+	text string,
+	visibleTo *Account,
+	page, pageSize int,
+) ([]PluginSearchResult, int64, error) {
+	terms := strings.Fields(text)
+	if len(terms) == 0 {
+		return []PluginSearchResult{}, 0, nil
+	}
+	query := storage.onlyVisiblePlugins(storage.db.Model(&Plugin{}), visibleTo)
+	for _, term := range terms {
+		pattern := likePattern(term)
+		query = query.Where(
+			"plugins.name LIKE ? ESCAPE '\\' OR plugins.summary_short LIKE ? ESCAPE '\\'"+
+				" OR plugins.summary_long LIKE ? ESCAPE '\\' OR plugins.tags LIKE ? ESCAPE '\\'"+
+				" OR EXISTS (SELECT 1 FROM plugin_versions WHERE plugin_versions.plugin_id = plugins.id"+
+				" AND plugin_versions.version = plugins.current_version"+
+				" AND plugin_versions.deleted_at IS NULL AND plugin_versions.code LIKE ? ESCAPE '\\')",
+			pattern, pattern, pattern, pattern, pattern,
+		)
+	}
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+	plugins := []Plugin{}
+	err := query.Order("plugins.name COLLATE NOCASE ASC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&plugins).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search plugins: %w", err)
+	}
+	results := make([]PluginSearchResult, 0, len(plugins))
+	for _, plugin := range plugins {
+		results = append(results, PluginSearchResult{Plugin: plugin})
+	}
+	return results, total, nil
+}
+
+// Turn free text into an FTS5 query matching entries containing all of its words
+// Every word is quoted so that FTS5 syntax in the text has no effect
+// The last word is matched as prefix to allow searching while typing
+func ftsQuery(text string) string {
+	terms := strings.Fields(text)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	if len(terms) > 0 {
+		terms[len(terms)-1] += "*"
+	}
+	return strings.Join(terms, " ")
+}
+
+// Escape a snippet for html and turn the match markers into <mark> tags
+func highlightSnippet(snippet string) string {
+	return strings.NewReplacer(
+		snippetMatchStart, "<mark>",
+		snippetMatchEnd, "</mark>",
+	).Replace(html.EscapeString(snippet))
+}
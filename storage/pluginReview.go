@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Get all plugins waiting for approval by a moderator, oldest first
+func (storage *Storage) GetPendingPlugins() ([]Plugin, error) {
+	plugins := []Plugin{}
+	res := storage.db.Where("approved = ? AND rejected = ?", false, false).
+		Order("created_at").
+		Find(&plugins)
+	if res.Error != nil {
+		return nil, fmt.Errorf("failed to get pending plugins: %w", res.Error)
+	}
+	return plugins, nil
+}
+
+// Approve a plugin for publishing
+// Returns ErrUnauthorised if the given account isn't allowed to approve plugins
+func (storage *Storage) ApprovePlugin(pluginID uint, by *Account) error {
+	return storage.reviewPlugin(pluginID, by, true, "")
+}
+
+// Reject a plugin. The reason is shown to the plugin's author
+// Returns ErrUnauthorised if the given account isn't allowed to approve plugins
+func (storage *Storage) RejectPlugin(pluginID uint, by *Account, reason string) error {
+	return storage.reviewPlugin(pluginID, by, false, reason)
+}
+
+func (storage *Storage) reviewPlugin(pluginID uint, by *Account, approve bool, reason string) error {
+	if by == nil || !by.CanApprovePlugins {
+		return ErrUnauthorised
+	}
+	plugin, err := storage.GetPluginByID(pluginID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	plugin.Approved = approve
+	plugin.Rejected = !approve
+	plugin.RejectionReason = reason
+	plugin.ReviewedByID = by.ID
+	plugin.ReviewedAt = &now
+	logrus.WithFields(logrus.Fields{
+		"pluginID":    pluginID,
+		"moderatorID": by.ID,
+		"approved":    approve,
+		"reason":      reason,
+	}).Infoln("Plugin reviewed")
+	return storage.UpdatePlugin(plugin)
+}
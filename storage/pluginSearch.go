@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gitlab.com/mstarongitlab/goutils/sliceutils"
+	"gorm.io/gorm"
+
+	"github.com/mstarongithub/mk-plugin-repo/aiscript"
+	customtypes "github.com/mstarongithub/mk-plugin-repo/storage/customTypes"
+)
+
+const (
+	PLUGIN_SORT_NEWEST     = "newest"     // Newest plugins first
+	PLUGIN_SORT_UPDATED    = "updated"    // Most recently updated plugins first
+	PLUGIN_SORT_NAME       = "name"       // Alphabetically by name
+	PLUGIN_SORT_POPULARITY = "popularity" // Most downloaded plugins first
+)
+
+const DEFAULT_PAGE_SIZE = 25
+const MAX_PAGE_SIZE = 100
+
+// Filters for searching plugins. Zero values mean "don't filter by this"
+// With AiScriptVersion, the permission and risk filters apply to the version running on it instead of the current one
+type PluginFilter struct {
+	Name               string                  // Plugin name must contain this (case-insensitive)
+	Content            string                  // Short or long summary must contain this (case-insensitive)
+	Tags               []string                // Plugin must have all of these tags
+	Type               *customtypes.PluginType // Plugin must be of this type
+	AuthorID           *uint                   // Plugin must be made by this account
+	AiScriptVersion    string                  // Plugin must have a version that runs on this AiScript version
+	Permissions        []string                // The current version must request all of these permissions
+	ExcludePermissions []string                // The current version must request none of these permissions
+	MaxRisk            *aiscript.RiskLevel     // The current version must be at most this risky
+	Channel            *Channel                // Plugin must have a version in this channel
+	Sort               string                  // One of the PLUGIN_SORT_ constants. Defaults to newest
+	Page               int                     // Which page to get, starting at 1
+	PageSize           int                     // How many plugins per page. Capped at MAX_PAGE_SIZE
+	// Which account to search as. Unapproved plugins are only included for their maintainers and moderators
+	// Nil for unauthenticated requests
+	VisibleTo *Account
+}
+
+// The page size actually used for the filter, after applying the default and limit
+func (filter *PluginFilter) EffectivePageSize() int {
+	return EffectivePageSize(filter.PageSize)
+}
+
+// The page size actually used for a requested one, after applying the default and limit
+func EffectivePageSize(requested int) int {
+	if requested <= 0 {
+		return DEFAULT_PAGE_SIZE
+	}
+	return min(requested, MAX_PAGE_SIZE)
+}
+
+// Search plugins with the given filter
+// Returns the plugins on the requested page and the total amount of matching plugins
+func (storage *Storage) FindPlugins(filter PluginFilter) ([]Plugin, int64, error) {
+	query, err := storage.pluginFilterQuery(&filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if res := query.Session(&gorm.Session{}).Count(&total); res.Error != nil {
+		return nil, 0, fmt.Errorf("failed to count plugins matching filter: %w", res.Error)
+	}
+
+	pageSize := filter.EffectivePageSize()
+	page := max(filter.Page, 1)
+
+	switch filter.Sort {
+	case PLUGIN_SORT_UPDATED:
+		query = query.Order("plugins.updated_at DESC")
+	case PLUGIN_SORT_NAME:
+		query = query.Order("plugins.name COLLATE NOCASE ASC")
+	case PLUGIN_SORT_POPULARITY:
+		query = query.Order("plugins.downloads DESC")
+	default:
+		query = query.Order("plugins.created_at DESC")
+	}
+	// Stable order for plugins that are equal in the sort criteria
+	query = query.Order("plugins.id DESC")
+
+	plugins := []Plugin{}
+	res := query.Limit(pageSize).Offset((page - 1) * pageSize).Find(&plugins)
+	if res.Error != nil {
+		return nil, 0, fmt.Errorf("failed to get plugins matching filter: %w", res.Error)
+	}
+	logrus.WithFields(logrus.Fields{
+		"filter": filter,
+		"total":  total,
+		"found":  len(plugins),
+	}).Debugln("Searched plugins")
+	return plugins, total, nil
+}
+
+// Count a download of a plugin. Used for sorting by popularity
+func (storage *Storage) CountPluginDownload(pluginID uint) error {
+	res := storage.db.Model(&Plugin{}).
+		Where("id = ?", pluginID).
+		UpdateColumn("downloads", gorm.Expr("downloads + 1"))
+	return res.Error
+}
+
+func (storage *Storage) pluginFilterQuery(filter *PluginFilter) (*gorm.DB, error) {
+	query := storage.onlyVisiblePlugins(storage.db.Model(&Plugin{}), filter.VisibleTo)
+
+	if filter.Name != "" {
+		query = query.Where("plugins.name LIKE ? ESCAPE '\\'", likePattern(filter.Name))
+	}
+	if filter.Content != "" {
+		pattern := likePattern(filter.Content)
+		query = query.Where(
+			"plugins.summary_short LIKE ? ESCAPE '\\' OR plugins.summary_long LIKE ? ESCAPE '\\'",
+			pattern,
+			pattern,
+		)
+	}
+	for _, tag := range filter.Tags {
+		query = query.Where(
+			"EXISTS (SELECT 1 FROM json_each(plugins.tags) WHERE json_each.value = ?)",
+			tag,
+		)
+	}
+	if filter.Type != nil {
+		query = query.Where("plugins.type = ?", int(*filter.Type))
+	}
+	if filter.AuthorID != nil {
+		query = query.Where("plugins.author_id = ?", *filter.AuthorID)
+	}
+	if filter.AiScriptVersion != "" {
+		targets, err := storage.targetsRunningOn(filter.AiScriptVersion)
+		if err != nil {
+			return nil, err
+		}
+		channels := Channels
+		if filter.Channel != nil {
+			channels = sliceutils.Filter(Channels, filter.Channel.Includes)
+		}
+		// Only published versions count, those are the ones listed by the plugin
+		// The permission filters apply to the compatible version, since that one is shown as current
+		sql := "EXISTS (SELECT 1 FROM plugin_versions WHERE plugin_versions.plugin_id = plugins.id" +
+			" AND plugin_versions.ai_script_version IN ?" +
+			" AND plugin_versions.channel IN ?" +
+			" AND plugin_versions.version IN (SELECT value FROM json_each(plugins.previous_versions))" +
+			" AND plugin_versions.deleted_at IS NULL"
+		args := []any{targets, channels}
+		conditions, conditionArgs := filter.permissionConditions("plugin_versions")
+		for _, condition := range conditions {
+			sql += " AND " + condition
+		}
+		query = query.Where(sql+")", append(args, conditionArgs...)...)
+	} else {
+		conditions, args := filter.permissionConditions("plugins")
+		for i, condition := range conditions {
+			query = query.Where(condition, args[i])
+		}
+	}
+	if filter.Channel != nil {
+		query = query.Where("json_type(plugins.current_versions, ?) IS NOT NULL", "$."+string(*filter.Channel))
+	}
+	return query, nil
+}
+
+// Get the sql conditions for the permission and risk filters, applied to the given table
+// Each condition takes exactly one argument
+func (filter *PluginFilter) permissionConditions(table string) (conditions []string, args []any) {
+	for _, permission := range filter.Permissions {
+		conditions = append(conditions,
+			"EXISTS (SELECT 1 FROM json_each("+table+".permissions) WHERE json_each.value = ?)")
+		args = append(args, permission)
+	}
+	if len(filter.ExcludePermissions) > 0 {
+		conditions = append(conditions,
+			"NOT EXISTS (SELECT 1 FROM json_each("+table+".permissions) WHERE json_each.value IN ?)")
+		args = append(args, filter.ExcludePermissions)
+	}
+	if filter.MaxRisk != nil {
+		allowed := sliceutils.Filter(aiscript.RiskLevels, func(level aiscript.RiskLevel) bool {
+			return level.AtMost(*filter.MaxRisk)
+		})
+		conditions = append(conditions, table+".risk_level IN ?")
+		args = append(args, allowed)
+	}
+	return conditions, args
+}
+
+// Whether a version passes the permission and risk filters
+func (filter *PluginFilter) versionMatches(version *PluginVersion) bool {
+	for _, permission := range filter.Permissions {
+		if !slices.Contains(version.Permissions, permission) {
+			return false
+		}
+	}
+	if slices.ContainsFunc(version.Permissions, func(permission string) bool {
+		return slices.Contains(filter.ExcludePermissions, permission)
+	}) {
+		return false
+	}
+	return filter.MaxRisk == nil || aiscript.RiskLevel(version.RiskLevel).AtMost(*filter.MaxRisk)
+}
+
+// Restrict a query on plugins to those the given account may see
+// Nil means an unauthenticated request, which only sees approved plugins
+func (storage *Storage) onlyVisiblePlugins(query *gorm.DB, acc *Account) *gorm.DB {
+	switch {
+	case acc == nil:
+		return query.Where(sqlPluginPublic)
+	case !acc.CanApprovePlugins:
+		return query.Where(
+			storage.db.Where(sqlPluginPublic).Or(sqlPluginManagedBy, acc.ID, acc.ID),
+		)
+	default:
+		return query
+	}
+}
+
+// Build a pattern for LIKE matching anything containing the given string
+func likePattern(contains string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(contains)
+	return "%" + escaped + "%"
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/mstarongithub/mk-plugin-repo/aiscript"
+)
+
+var ErrNoCompatibleVersion = errors.New("no version is compatible with the AiScript version")
+
+// Get the plugins with the given name the account may see. The name is matched case-insensitively
+// Names aren't unique, so there may be several
+func (storage *Storage) FindPluginsByName(name string, visibleTo *Account) ([]Plugin, error) {
+	plugins := []Plugin{}
+	res := storage.onlyVisiblePlugins(storage.db.Model(&Plugin{}), visibleTo).
+		Where("plugins.name = ? COLLATE NOCASE", name).
+		Order("plugins.id").
+		Find(&plugins)
+	if res.Error != nil {
+		return nil, fmt.Errorf("failed to find plugins named %q: %w", name, res.Error)
+	}
+	return plugins, nil
+}
+
+// Get the newest version of a plugin in the channel that runs on the given AiScript version
+// Versions targeting unknown AiScript versions don't run anywhere. If aiscriptVersion is empty, any runs
+// Yanked versions and versions held for review are never picked
+// The current version of the channel is preferred, older ones are only picked if it isn't compatible
+// The returned version is loaded without its code
+// Returns ErrNoCompatibleVersion if no version fits
+func (storage *Storage) NewestCompatibleVersion(
+	plugin *Plugin,
+	channel Channel,
+	aiscriptVersion string,
+) (*PluginVersion, error) {
+	versions, err := storage.publishedVersions(plugin)
+	if err != nil {
+		return nil, err
+	}
+	return newestVersionWhere(plugin, versions, channel, func(version *PluginVersion) bool {
+		return aiscript.RunsOn(version.AiScriptVersion, aiscriptVersion)
+	})
+}
+
+// Get the published versions of a plugin by name, without their code, in a single query
+func (storage *Storage) publishedVersions(plugin *Plugin) (map[string]*PluginVersion, error) {
+	versions := []PluginVersion{}
+	res := storage.db.Omit("code").
+		Where("plugin_id = ?", plugin.ID).
+		Where("version IN ?", []string(plugin.PreviousVersions)).
+		Find(&versions)
+	if res.Error != nil {
+		return nil, fmt.Errorf("failed to get the versions of plugin %d: %w", plugin.ID, res.Error)
+	}
+	byName := make(map[string]*PluginVersion, len(versions))
+	for i := range versions {
+		byName[versions[i].Version] = &versions[i]
+	}
+	return byName, nil
+}
+
+// Pick the newest of the published versions in the channel that fits. Otherwise like NewestCompatibleVersion
+func newestVersionWhere(
+	plugin *Plugin,
+	versions map[string]*PluginVersion,
+	channel Channel,
+	fits func(*PluginVersion) bool,
+) (*PluginVersion, error) {
+	current, ok := plugin.CurrentVersions[channel]
+	if !ok {
+		return nil, ErrNoVersionInChannel
+	}
+	version, ok := versions[current]
+	if !ok {
+		return nil, ErrVersionNotFound
+	}
+	if fits(version) {
+		return version, nil
+	}
+
+	candidates := SortVersionNames(plugin.PreviousVersions)
+	slices.Reverse(candidates)
+	for _, name := range candidates {
+		if name == current || !channel.Includes(ChannelOf(name)) {
+			continue
+		}
+		if version, ok := versions[name]; ok && fits(version) {
+			return version, nil
+		}
+	}
+	return nil, ErrNoCompatibleVersion
+}
+
+// Switch the plugin over to its newest version that runs on the AiScript version of the filter
+// and passes its permission and risk filters, like FindPlugins selected it by
+// Without channel, the most stable channel with such a version is used
+// Updates CurrentVersion, Permissions and RiskLevel like PluginInChannel. Nothing is saved
+// Returns ErrNoCompatibleVersion if no version fits
+func (storage *Storage) PluginForAiScript(plugin *Plugin, filter *PluginFilter) error {
+	channels := Channels
+	if filter.Channel != nil {
+		channels = []Channel{*filter.Channel}
+	}
+	versions, err := storage.publishedVersions(plugin)
+	if err != nil {
+		return err
+	}
+	fits := func(version *PluginVersion) bool {
+		return aiscript.RunsOn(version.AiScriptVersion, filter.AiScriptVersion) && filter.versionMatches(version)
+	}
+	for _, candidate := range channels {
+		version, err := newestVersionWhere(plugin, versions, candidate, fits)
+		if errors.Is(err, ErrNoCompatibleVersion) || errors.Is(err, ErrNoVersionInChannel) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		plugin.CurrentVersion = version.Version
+		plugin.Permissions = version.Permissions
+		plugin.RiskLevel = version.RiskLevel
+		return nil
+	}
+	return ErrNoCompatibleVersion
+}
+
+// Get the distinct AiScript versions targeted by any version that run on the given AiScript version
+func (storage *Storage) targetsRunningOn(aiscriptVersion string) ([]string, error) {
+	targets := []string{}
+	res := storage.db.Model(&PluginVersion{}).Distinct().Pluck("ai_script_version", &targets)
+	if res.Error != nil {
+		return nil, fmt.Errorf("failed to get targeted AiScript versions: %w", res.Error)
+	}
+	return slices.DeleteFunc(targets, func(target string) bool {
+		return !aiscript.RunsOn(target, aiscriptVersion)
+	}), nil
+}
@@ -1,26 +1,65 @@
 package storage
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"gitlab.com/mstarongitlab/goutils/sliceutils"
 	"gorm.io/gorm"
+
+	"github.com/mstarongithub/mk-plugin-repo/aiscript"
 )
 
 type PluginVersion struct {
 	gorm.Model
-	Version         string `gorm:"version;<-create"`           // The version string
-	Code            string `gorm:"code;<-:create"`             // Raw code for this version
-	PluginID        uint   `gorm:"plugin_id;<-:create"`        // The plugin ID this version belongs to
-	AiScriptVersion string `gorm:"aiscript_version;<-:create"` // The targeted AIScript version this plugin version was made for
+	Version         string  `gorm:"version;<-create"`           // The version string
+	Code            string  `gorm:"code;<-:create"`             // Raw code for this version
+	CodeSHA256      string  `gorm:"<-:create"`                  // Hex encoded SHA-256 hash of the code
+	PluginID        uint    `gorm:"plugin_id;<-:create"`        // The plugin ID this version belongs to
+	AiScriptVersion string  `gorm:"aiscript_version;<-:create"` // The targeted AIScript version this plugin version was made for
+	Channel         Channel `gorm:"<-:create"`                  // Release channel, derived from the version name
+	Changelog       string  `gorm:"<-:create"`                  // Markdown formatted notes on what changed in this version
+	UploadedByID    uint    `gorm:"<-:create"`                  // ID of the account that uploaded this version. 0 for old versions
+	// Metadata declared in the header of the code
+	DeclaredName        string                 `gorm:"<-:create"`                 // Name of the plugin according to the code
+	DeclaredAuthor      string                 `gorm:"<-:create"`                 // Author according to the code
+	DeclaredDescription string                 `gorm:"<-:create"`                 // Description according to the code
+	Permissions         []string               `gorm:"serializer:json;<-:create"` // Misskey API permissions the code requests
+	ConfigFields        []aiscript.ConfigField `gorm:"serializer:json;<-:create"` // The settings in the config, in declaration order
+	RiskLevel           string                 `gorm:"<-:create"`                 // How risky the requested permissions are. One of the aiscript.RISK_ constants
+	// Difference in permissions to the version that was current when this one was uploaded
+	AddedPermissions   []string `gorm:"serializer:json;<-:create"` // Permissions this version requests that the previous one didn't
+	RemovedPermissions []string `gorm:"serializer:json;<-:create"` // Permissions the previous version requested that this one doesn't
+	// Potential problems the linter found in the code, for reviewers
+	LintFindings []aiscript.Finding `gorm:"serializer:json;<-:create"`
+	// Versions requesting more permissions than the previous one of an approved plugin
+	// are held back until a moderator approved them
+	HeldForReview   bool
+	ReviewedByID    uint       // ID of the moderator who approved or rejected this version
+	ReviewedAt      *time.Time // When a moderator approved or rejected this version
+	RejectionReason string     // Why a moderator rejected this version. Rejected versions are hidden
+	// Yanked versions stay fetchable, but are no longer listed and never current
+	Yanked     bool
+	YankedByID uint       // ID of the account that yanked this version
+	YankedAt   *time.Time // When this version was yanked
+	YankReason string     // Why this version was yanked
+	// Detached ed25519 signature of the code by its uploader. Empty if the version isn't signed
+	SignedByID            uint   `gorm:"<-:create"` // ID of the account whose key made the signature
+	SigningKeyID          uint   `gorm:"<-:create"` // ID of the key that made the signature
+	SigningKeyFingerprint string `gorm:"<-:create"` // Fingerprint of that key, see KeyFingerprint
+	Signature             []byte `gorm:"<-:create"` // The raw signature
 }
 
 var ErrVersionAlreadyExists = errors.New("version already exists")
 
-// Get all versions for a plugin
-// Will return empty list if that plugin doesn't exist
+// Get all versions for a plugin, newest first
 // Will return empty list if that plugin doesn't exist
 func (storage *Storage) GetVersionsFor(pluginID uint) []PluginVersion {
 	logrus.WithFields(logrus.Fields{
@@ -29,7 +68,7 @@ func (storage *Storage) GetVersionsFor(pluginID uint) []PluginVersion {
 	}).
 		Debugln("storage: Attempting to get versions for plugin")
 	plugins := []PluginVersion{}
-	result := storage.db.Find(plugins, "plugin_id = ?", pluginID)
+	result := storage.db.Order("created_at DESC").Find(&plugins, "plugin_id = ?", pluginID)
 	if result.Error != nil {
 		logrus.WithFields(logrus.Fields{
 			"pluginID": pluginID,
@@ -92,14 +131,38 @@ func (storage *Storage) HideVersion(pluginID uint, versionName string) error {
 		}
 	}
 	storage.db.Delete(version)
+	plugin, err := storage.GetPluginByID(pluginID)
+	if err != nil {
+		return err
+	}
+	// Versions held for review were never added to the plugin
+	if !slices.Contains(plugin.PreviousVersions, versionName) {
+		storage.reindexPlugin(pluginID)
+		return nil
+	}
+	plugin.PreviousVersions = slices.DeleteFunc(
+		plugin.PreviousVersions,
+		func(name string) bool { return name == versionName },
+	)
 	// TODO: Add logging
-	return nil
+	return storage.refreshCurrentVersion(plugin)
 }
 
+// Add a new version to a plugin. It becomes the current one if it is the highest stable version
+// The version name must be a semantic version unless the config allows others
+// If the plugin is approved and the version requests permissions the current version doesn't,
+// it is held for review instead and only becomes current once a moderator approved it
+// uploaderID is the account uploading the version
+// signature must already be verified with VerifyCodeSignature. Nil if the version isn't signed
 func (storage *Storage) NewVersion(
-	forPluginID uint,
-	versionName, code, aiscript_version string,
-) error {
+	forPluginID, uploaderID uint,
+	versionName, code, aiscript_version, changelog string,
+	meta *aiscript.Metadata,
+	signature *CodeSignature,
+) (*PluginVersion, error) {
+	if err := ValidateVersionName(versionName); err != nil {
+		return nil, err
+	}
 	// First check if a version already exists
 	_, err := storage.TryFindVersion(forPluginID, versionName)
 	if err == nil {
@@ -107,20 +170,20 @@ func (storage *Storage) NewVersion(
 			"pluginID":    forPluginID,
 			"versionName": versionName,
 		}).Debugln("Got no error while looking if a new version already exists. Assuming it exists already, aborting")
-		return ErrAlreadyExists
+		return nil, ErrAlreadyExists
 	} else if !errors.Is(err, ErrVersionNotFound) {
 		logrus.WithError(err).WithFields(logrus.Fields{
 			"pluginID":    forPluginID,
 			"versionName": versionName,
 		}).Debugln("Got err that is not ErrVersionNotFound from check if plugin version exists, aborting")
-		return err
+		return nil, err
 	}
 
 	// Then check if there actually is a plugin with the given ID
-	_, err = storage.GetPluginByID(forPluginID)
+	plugin, err := storage.GetPluginByID(forPluginID)
 	if err != nil {
 		// TODO: Add logging
-		return err
+		return nil, err
 	}
 
 	// Now make the new version, push it to the db
@@ -128,22 +191,178 @@ func (storage *Storage) NewVersion(
 		PluginID:        forPluginID,
 		Version:         versionName,
 		Code:            code,
+		CodeSHA256:      hashCode(code),
 		AiScriptVersion: aiscript_version,
+		Channel:         ChannelOf(versionName),
+		Changelog:       changelog,
+		UploadedByID:    uploaderID,
+		// An empty list rather than null marks the config as parsed, see backfillConfigFields
+		ConfigFields: []aiscript.ConfigField{},
+	}
+	if meta != nil {
+		newVersion.DeclaredName = meta.Name
+		newVersion.DeclaredAuthor = meta.Author
+		newVersion.DeclaredDescription = meta.Description
+		newVersion.Permissions = meta.Permissions
+		if meta.ConfigFields != nil {
+			newVersion.ConfigFields = meta.ConfigFields
+		}
 	}
+	if signature != nil {
+		newVersion.SignedByID = signature.Key.AccountID
+		newVersion.SigningKeyID = signature.Key.ID
+		newVersion.SigningKeyFingerprint = signature.Key.Fingerprint
+		newVersion.Signature = signature.Signature
+	}
+	newVersion.RiskLevel = string(aiscript.ClassifyPermissions(newVersion.Permissions))
+	newVersion.LintFindings = aiscript.Lint(code, meta)
+	newVersion.AddedPermissions, newVersion.RemovedPermissions = aiscript.DiffPermissions(
+		plugin.Permissions,
+		newVersion.Permissions,
+	)
+	// Unapproved plugins get reviewed as a whole anyways
+	newVersion.HeldForReview = plugin.Approved && len(newVersion.AddedPermissions) > 0
 	// TODO: Add logging
 	result := storage.db.Create(&newVersion)
 	if result.Error != nil {
 		// TODO: Add logging
-		return fmt.Errorf("error trying to create new version: %w", result.Error)
+		return nil, fmt.Errorf("error trying to create new version: %w", result.Error)
+	}
+
+	if newVersion.HeldForReview {
+		logrus.WithFields(logrus.Fields{
+			"pluginID":         forPluginID,
+			"versionName":      versionName,
+			"addedPermissions": newVersion.AddedPermissions,
+		}).Infoln("New version requests more permissions, holding it for review")
+		return &newVersion, nil
 	}
 
 	// And update the parent plugin
 	_, err = storage.PushNewPluginVersion(forPluginID, versionName)
 	if err != nil {
 		// TODO: Add logging
-		return fmt.Errorf("failed to update plugin info: %w", err)
+		return nil, fmt.Errorf("failed to update plugin info: %w", err)
 	}
 
 	// TODO: Add logging
+	return &newVersion, nil
+}
+
+// Get the hex encoded SHA-256 hash of code
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// Subresource integrity string of the code, like "sha256-<base64 of the hash>"
+func (version *PluginVersion) Integrity() string {
+	sum, err := hex.DecodeString(version.CodeSHA256)
+	if err != nil {
+		return ""
+	}
+	return "sha256-" + base64.StdEncoding.EncodeToString(sum)
+}
+
+// Hash the code of versions uploaded before hashes were stored
+func backfillCodeHashes(db *gorm.DB) error {
+	versions := []PluginVersion{}
+	res := db.Unscoped().Where("code_sha256 IS NULL OR code_sha256 = ''").Find(&versions)
+	if res.Error != nil {
+		return fmt.Errorf("failed to get versions without code hash: %w", res.Error)
+	}
+	if len(versions) > 0 {
+		logrus.WithField("amount", len(versions)).Infoln("Hashing code of old plugin versions")
+	}
+	for _, version := range versions {
+		err := db.Exec(
+			"UPDATE plugin_versions SET code_sha256 = ? WHERE id = ?",
+			hashCode(version.Code),
+			version.ID,
+		).Error
+		if err != nil {
+			return fmt.Errorf("failed to store code hash of version %d: %w", version.ID, err)
+		}
+	}
+	return nil
+}
+
+// Parse the config settings of versions uploaded before they were stored
+// Versions whose config is malformed get no settings
+func backfillConfigFields(db *gorm.DB) error {
+	versions := []PluginVersion{}
+	res := db.Unscoped().Where("config_fields IS NULL").Find(&versions)
+	if res.Error != nil {
+		return fmt.Errorf("failed to get versions without config fields: %w", res.Error)
+	}
+	if len(versions) > 0 {
+		logrus.WithField("amount", len(versions)).Infoln("Parsing config of old plugin versions")
+	}
+	for _, version := range versions {
+		fields := []aiscript.ConfigField{}
+		if meta, err := aiscript.ParseMetadata(version.Code); err == nil && meta.ConfigFields != nil {
+			fields = meta.ConfigFields
+		}
+		encoded, err := json.Marshal(fields)
+		if err != nil {
+			return fmt.Errorf("failed to encode config fields: %w", err)
+		}
+		err = db.Exec("UPDATE plugin_versions SET config_fields = ? WHERE id = ?", string(encoded), version.ID).Error
+		if err != nil {
+			return fmt.Errorf("failed to store config fields of version %d: %w", version.ID, err)
+		}
+	}
+	return nil
+}
+
+// Fill in the metadata of versions uploaded before it was parsed on upload
+// Also copies the permissions and risk level of current versions to their plugins
+func backfillVersionMetadata(db *gorm.DB) error {
+	versions := []PluginVersion{}
+	res := db.Unscoped().Where("risk_level IS NULL OR risk_level = ''").Find(&versions)
+	if res.Error != nil {
+		return fmt.Errorf("failed to get versions without metadata: %w", res.Error)
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+	logrus.WithField("amount", len(versions)).Infoln("Parsing metadata of old plugin versions")
+	for _, version := range versions {
+		meta, err := aiscript.ParseMetadata(version.Code)
+		if err != nil {
+			logrus.WithError(err).
+				WithField("versionID", version.ID).
+				Warnln("Metadata of old plugin version is malformed, treating it as empty")
+			meta = &aiscript.Metadata{}
+		}
+		permissions, err := json.Marshal(meta.Permissions)
+		if err != nil {
+			return fmt.Errorf("failed to encode permissions: %w", err)
+		}
+		err = db.Exec(
+			"UPDATE plugin_versions SET declared_name = ?, declared_author = ?, declared_description = ?,"+
+				" permissions = ?, risk_level = ? WHERE id = ?",
+			meta.Name,
+			meta.Author,
+			meta.Description,
+			string(permissions),
+			string(aiscript.ClassifyPermissions(meta.Permissions)),
+			version.ID,
+		).Error
+		if err != nil {
+			return fmt.Errorf("failed to store metadata of version %d: %w", version.ID, err)
+		}
+	}
+	err := db.Exec(
+		"UPDATE plugins SET" +
+			" permissions = (SELECT permissions FROM plugin_versions" +
+			" WHERE plugin_versions.plugin_id = plugins.id AND plugin_versions.version = plugins.current_version)," +
+			" risk_level = (SELECT risk_level FROM plugin_versions" +
+			" WHERE plugin_versions.plugin_id = plugins.id AND plugin_versions.version = plugins.current_version)" +
+			" WHERE risk_level IS NULL OR risk_level = ''",
+	).Error
+	if err != nil {
+		return fmt.Errorf("failed to copy permissions of current versions to plugins: %w", err)
+	}
 	return nil
 }
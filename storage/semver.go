@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mstarongithub/mk-plugin-repo/config"
+)
+
+// A semantic version as specified by https://semver.org
+type Semver struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	Prerelease []string // Dot separated identifiers after the "-". Empty for stable versions
+	Build      string   // Build metadata after the "+". Ignored for ordering
+}
+
+var ErrInvalidVersionName = errors.New("version name is not a valid semantic version")
+
+// The official regex from semver.org
+var semverRegex = regexp.MustCompile(
+	`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+		`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+		`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`,
+)
+
+// Parse a version name like "1.2.3-beta.1+build5"
+// Returns an error wrapping ErrInvalidVersionName if it isn't a semantic version
+func ParseSemver(name string) (*Semver, error) {
+	match := semverRegex.FindStringSubmatch(name)
+	if match == nil {
+		return nil, fmt.Errorf("%w: %q, expected something like 1.2.3", ErrInvalidVersionName, name)
+	}
+	version := Semver{Build: match[5]}
+	var err error
+	for i, target := range []*uint64{&version.Major, &version.Minor, &version.Patch} {
+		*target, err = strconv.ParseUint(match[i+1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q, number too large", ErrInvalidVersionName, name)
+		}
+	}
+	if match[4] != "" {
+		version.Prerelease = strings.Split(match[4], ".")
+	}
+	return &version, nil
+}
+
+// Stable versions are those without prerelease identifiers
+func (v *Semver) IsStable() bool {
+	return len(v.Prerelease) == 0
+}
+
+// Compare the precedence of two versions. Returns -1 if v is lower, 1 if it is higher and 0 if they are equal
+func (v *Semver) Compare(other *Semver) int {
+	if c := cmp.Compare(v.Major, other.Major); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(v.Minor, other.Minor); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(v.Patch, other.Patch); c != 0 {
+		return c
+	}
+	// A prerelease has lower precedence than the stable version
+	switch {
+	case v.IsStable() && other.IsStable():
+		return 0
+	case v.IsStable():
+		return 1
+	case other.IsStable():
+		return -1
+	}
+	for i := 0; i < len(v.Prerelease) && i < len(other.Prerelease); i++ {
+		if c := comparePrereleaseIdentifier(v.Prerelease[i], other.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(v.Prerelease), len(other.Prerelease))
+}
+
+// Numeric identifiers are compared numerically and are lower than alphanumeric ones,
+// which are compared lexically
+func comparePrereleaseIdentifier(a, b string) int {
+	numA, errA := strconv.ParseUint(a, 10, 64)
+	numB, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		return cmp.Compare(numA, numB)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+// Whether version names that aren't semantic versions are accepted
+func lenientVersionNames() bool {
+	return config.GlobalConfig != nil && config.GlobalConfig.Versions.AllowNonSemver
+}
+
+// Check whether a version name can be used for a new version
+// Returns an error wrapping ErrInvalidVersionName if it isn't a semantic version
+// and non-semver names aren't allowed by the config
+func ValidateVersionName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: empty version name", ErrInvalidVersionName)
+	}
+	if lenientVersionNames() {
+		return nil
+	}
+	_, err := ParseSemver(name)
+	return err
+}
+
+// Compare the precedence of two version names
+// Names that aren't semantic versions rank below all that are and equal to each other
+func CompareVersionNames(a, b string) int {
+	versionA, errA := ParseSemver(a)
+	versionB, errB := ParseSemver(b)
+	switch {
+	case errA == nil && errB == nil:
+		return versionA.Compare(versionB)
+	case errA == nil:
+		return 1
+	case errB == nil:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// Get a copy of the version names, sorted from lowest to highest precedence
+// Names that aren't semantic versions come first, in their original order
+func SortVersionNames(names []string) []string {
+	sorted := slices.Clone(names)
+	slices.SortStableFunc(sorted, CompareVersionNames)
+	return sorted
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/mstarongithub/mk-plugin-repo/config"
+)
+
+func TestParseSemver(t *testing.T) {
+	tests := []struct {
+		name string
+		want Semver
+	}{
+		{"0.0.0", Semver{}},
+		{"1.2.3", Semver{Major: 1, Minor: 2, Patch: 3}},
+		{"10.20.30", Semver{Major: 10, Minor: 20, Patch: 30}},
+		{"1.0.0-alpha", Semver{Major: 1, Prerelease: []string{"alpha"}}},
+		{"1.0.0-beta.1", Semver{Major: 1, Prerelease: []string{"beta", "1"}}},
+		{"1.0.0-0.3.7", Semver{Major: 1, Prerelease: []string{"0", "3", "7"}}},
+		{"1.0.0-x-y.7z", Semver{Major: 1, Prerelease: []string{"x-y", "7z"}}},
+		{"1.0.0+build.5", Semver{Major: 1, Build: "build.5"}},
+		{"1.2.3-rc.1+sha.5114f85", Semver{Major: 1, Minor: 2, Patch: 3, Prerelease: []string{"rc", "1"}, Build: "sha.5114f85"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseSemver(test.name)
+			if err != nil {
+				t.Fatalf("ParseSemver() error = %v", err)
+			}
+			if got.Major != test.want.Major || got.Minor != test.want.Minor || got.Patch != test.want.Patch ||
+				!slices.Equal(got.Prerelease, test.want.Prerelease) || got.Build != test.want.Build {
+				t.Errorf("ParseSemver() = %+v, want %+v", *got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseSemverRejectsInvalidNames(t *testing.T) {
+	names := []string{
+		"",
+		"1",
+		"1.2",
+		"1.2.3.4",
+		"v1.2.3",
+		"01.2.3",
+		"1.02.3",
+		"1.2.03",
+		"1.2.3-",
+		"1.2.3-01",
+		"1.2.3-beta..1",
+		"1.2.3+",
+		"1.2.3 ",
+		"latest",
+		"99999999999999999999.0.0",
+	}
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseSemver(name)
+			if !errors.Is(err, ErrInvalidVersionName) {
+				t.Errorf("ParseSemver(%q) error = %v, want ErrInvalidVersionName", name, err)
+			}
+		})
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	// Ascending precedence, the example from semver.org plus a few more
+	ordered := []string{
+		"0.9.9",
+		"1.0.0-0.3.7",
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.2.0",
+		"1.10.0",
+		"2.0.0",
+	}
+	for i, a := range ordered {
+		for j, b := range ordered {
+			versionA, errA := ParseSemver(a)
+			versionB, errB := ParseSemver(b)
+			if errA != nil || errB != nil {
+				t.Fatalf("failed to parse %q or %q: %v, %v", a, b, errA, errB)
+			}
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := versionA.Compare(versionB); got != want {
+				t.Errorf("Compare(%q, %q) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestSemverCompareIgnoresBuild(t *testing.T) {
+	tests := [][2]string{
+		{"1.0.0+a", "1.0.0+b"},
+		{"1.0.0", "1.0.0+build.1"},
+		{"1.0.0-beta+exp.sha.5114f85", "1.0.0-beta"},
+	}
+	for _, test := range tests {
+		a, _ := ParseSemver(test[0])
+		b, _ := ParseSemver(test[1])
+		if got := a.Compare(b); got != 0 {
+			t.Errorf("Compare(%q, %q) = %d, want 0", test[0], test[1], got)
+		}
+	}
+}
+
+func TestCompareVersionNames(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "2.0.0", -1},
+		{"1.0.0-beta", "1.0.0", -1},
+		{"1.0.0", "1.0.0", 0},
+		// Names that aren't semantic versions rank below all that are
+		{"latest", "0.0.1", -1},
+		{"0.0.1-alpha", "v2", 1},
+		{"v2", "v10", 0},
+		{"latest", "latest", 0},
+	}
+	for _, test := range tests {
+		if got := CompareVersionNames(test.a, test.b); got != test.want {
+			t.Errorf("CompareVersionNames(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestSortVersionNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{"empty", []string{}, []string{}},
+		{
+			"semantic versions",
+			[]string{"1.10.0", "1.2.0", "1.0.0", "1.0.0-rc.1", "1.0.0-beta.11", "1.0.0-beta.2"},
+			[]string{"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.2.0", "1.10.0"},
+		},
+		{
+			"non-semver names first, in their original order",
+			[]string{"1.0.0", "v2", "0.1.0", "latest", "1.0"},
+			[]string{"v2", "latest", "1.0", "0.1.0", "1.0.0"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := slices.Clone(test.names)
+			got := SortVersionNames(test.names)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("SortVersionNames() = %v, want %v", got, test.want)
+			}
+			if !slices.Equal(test.names, original) {
+				t.Errorf("SortVersionNames() modified its input to %v", test.names)
+			}
+		})
+	}
+}
+
+func TestValidateVersionName(t *testing.T) {
+	previous := config.GlobalConfig
+	t.Cleanup(func() { config.GlobalConfig = previous })
+
+	tests := []struct {
+		name    string
+		lenient bool
+		wantErr bool
+	}{
+		{"1.2.3", false, false},
+		{"1.2.3-beta.1", false, false},
+		{"v1", false, true},
+		{"", false, true},
+		{"v1", true, false},
+		{"", true, true},
+	}
+	for _, test := range tests {
+		config.GlobalConfig = &config.Config{Versions: config.ConfigVersions{AllowNonSemver: test.lenient}}
+		err := ValidateVersionName(test.name)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ValidateVersionName(%q) with lenient names %v = %v, want error: %v",
+				test.name, test.lenient, err, test.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidVersionName) {
+			t.Errorf("ValidateVersionName(%q) error = %v, want ErrInvalidVersionName", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// An ed25519 public key an account signs plugin code with
+// Revoked keys are soft-deleted and kept, so that old signatures can still be verified
+type SigningKey struct {
+	gorm.Model
+	AccountID   uint   // The account owning the key
+	Name        string // A name given by the owner to identify the key
+	PublicKey   []byte // The raw ed25519 public key
+	Fingerprint string `gorm:"index"` // "SHA256:" followed by the unpadded base64 of the SHA-256 of the public key
+}
+
+// A detached signature of a version's code, already verified
+type CodeSignature struct {
+	Key       *SigningKey // The key that made the signature
+	Signature []byte      // The raw ed25519 signature of the code
+}
+
+var ErrInvalidPublicKey = errors.New("not an ed25519 public key")
+var ErrKeyAlreadyExists = errors.New("key is already registered")
+var ErrSigningKeyNotFound = errors.New("signing key not found")
+var ErrInvalidSignature = errors.New("signature doesn't match the code with any key of the account")
+
+// Get the fingerprint of a public key, in the same format OpenSSH uses
+func KeyFingerprint(publicKey []byte) string {
+	sum := sha256.Sum256(publicKey)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// Register a new public key for an account
+// Returns ErrInvalidPublicKey if it isn't 32 bytes long and ErrKeyAlreadyExists if any account registered it already
+func (storage *Storage) NewSigningKey(accountID uint, name string, publicKey []byte) (*SigningKey, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, ErrInvalidPublicKey
+	}
+	if _, err := storage.FindAccountByID(accountID); err != nil {
+		return nil, err
+	}
+	fingerprint := KeyFingerprint(publicKey)
+	var existing int64
+	res := storage.db.Unscoped().Model(&SigningKey{}).Where("fingerprint = ?", fingerprint).Count(&existing)
+	if res.Error != nil {
+		return nil, fmt.Errorf("failed to check for existing key: %w", res.Error)
+	}
+	if existing > 0 {
+		return nil, ErrKeyAlreadyExists
+	}
+	key := SigningKey{
+		AccountID:   accountID,
+		Name:        name,
+		PublicKey:   publicKey,
+		Fingerprint: fingerprint,
+	}
+	if res = storage.db.Create(&key); res.Error != nil {
+		return nil, fmt.Errorf("failed to insert signing key: %w", res.Error)
+	}
+	logrus.WithFields(logrus.Fields{
+		"accountID":   accountID,
+		"fingerprint": fingerprint,
+	}).Infoln("Registered new signing key")
+	return &key, nil
+}
+
+// Get the keys of an account, oldest first
+// Revoked keys are only included if includeRevoked is set. Their DeletedAt is when they were revoked
+func (storage *Storage) GetSigningKeysFor(accountID uint, includeRevoked bool) ([]SigningKey, error) {
+	query := storage.db
+	if includeRevoked {
+		query = query.Unscoped()
+	}
+	keys := []SigningKey{}
+	res := query.Where("account_id = ?", accountID).Order("id").Find(&keys)
+	if res.Error != nil {
+		return nil, fmt.Errorf("failed to get signing keys of account %d: %w", accountID, res.Error)
+	}
+	return keys, nil
+}
+
+// Revoke a key of an account. It can't be used for new signatures anymore
+// Returns ErrSigningKeyNotFound if the account has no active key with that ID
+func (storage *Storage) RevokeSigningKey(accountID, keyID uint) error {
+	res := storage.db.Where("account_id = ?", accountID).Delete(&SigningKey{}, keyID)
+	if res.Error != nil {
+		return fmt.Errorf("failed to revoke signing key %d: %w", keyID, res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrSigningKeyNotFound
+	}
+	logrus.WithFields(logrus.Fields{
+		"accountID": accountID,
+		"keyID":     keyID,
+	}).Infoln("Revoked signing key")
+	return nil
+}
+
+// Verify a detached signature of code against the active keys of an account
+// If fingerprint isn't empty, only the key with that fingerprint is tried
+// Returns ErrInvalidSignature if no key matches
+func (storage *Storage) VerifyCodeSignature(
+	accountID uint,
+	code string,
+	signature []byte,
+	fingerprint string,
+) (*CodeSignature, error) {
+	keys, err := storage.GetSigningKeysFor(accountID, false)
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		if fingerprint != "" && keys[i].Fingerprint != fingerprint {
+			continue
+		}
+		if ed25519.Verify(keys[i].PublicKey, []byte(code), signature) {
+			return &CodeSignature{Key: &keys[i], Signature: signature}, nil
+		}
+	}
+	return nil, ErrInvalidSignature
+}
+
+// When the key was revoked. Nil if it is still active
+func (key *SigningKey) RevokedAt() *time.Time {
+	if !key.DeletedAt.Valid {
+		return nil
+	}
+	return &key.DeletedAt.Time
+}
@@ -15,8 +15,8 @@ import (
 )
 
 type Storage struct {
-	db     *gorm.DB
-	tokens map[uint][]string
+	db             *gorm.DB
+	fullTextSearch bool // Whether the plugin full-text index is available
 }
 
 var ErrVersionNotFound = errors.New("version not found")
@@ -47,6 +47,10 @@ func NewStorage(sqliteFile string, customConfig *gorm.Config) (storage Storage,
 		&Account{},
 		&Plugin{},
 		&PluginVersion{},
+		&AccessToken{},
+		&SigningKey{},
+		&Instance{},
+		&PluginInstall{},
 	)
 	if err != nil {
 		// TODO: Add logging
@@ -60,8 +64,32 @@ func NewStorage(sqliteFile string, customConfig *gorm.Config) (storage Storage,
 		Approved:  true,
 		Confirmed: true,
 	})
+	if err = backfillVersionMetadata(db); err != nil {
+		return storage, err
+	}
+	if err = backfillChannels(db); err != nil {
+		return storage, err
+	}
+	if err = backfillCodeHashes(db); err != nil {
+		return storage, err
+	}
+	if err = backfillLintFindings(db); err != nil {
+		return storage, err
+	}
+	if err = backfillConfigFields(db); err != nil {
+		return storage, err
+	}
+	if err = backfillInstallDays(db); err != nil {
+		return storage, err
+	}
+	storage.fullTextSearch, err = setupPluginIndex(db)
+	if err != nil {
+		return storage, err
+	}
 	storage.db = db
-	storage.tokens = map[uint][]string{}
+	if err = storage.removeDanglingVersions(); err != nil {
+		return storage, err
+	}
 	return storage, nil
 }
 
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 
 	customtypes "github.com/mstarongithub/mk-plugin-repo/storage/customTypes"
@@ -24,6 +25,12 @@ type Account struct {
 	Description  string                         // A description of the account, added by the user. Not necessary
 	PluginsOwned customtypes.GenericSlice[uint] // IDs of plugins this account owns (has created)
 	Approved     bool                           // Is this account approved for performing any actions
+	// ID of the account that approved or rejected this one
+	// 0 if not reviewed yet
+	ReviewedByID    uint
+	ReviewedAt      *time.Time // When this account was approved or rejected
+	Rejected        bool       // Was this account rejected by a moderator?
+	RejectionReason string     // Why this account was rejected
 
 	// ---- authboss things ----
 	// Auth
@@ -93,6 +100,39 @@ func (s *Storage) FindAccountByID(id uint) (*Account, error) {
 	return &acc, nil
 }
 
+// Create a new, unapproved account
+// passwordHash must already be hashed, it is stored as is
+// Returns ErrAlreadyExists if an account with that name or mail already exists
+func (s *Storage) NewAccount(name, mail, passwordHash string) (*Account, error) {
+	if _, err := s.FindAccountByName(name); err == nil {
+		logrus.WithField("name", name).Debugln("Account with that name already exists")
+		return nil, ErrAlreadyExists
+	} else if !errors.Is(err, ErrAccountNotFound) {
+		return nil, err
+	}
+	if mail != "" {
+		placeholder := Account{}
+		s.db.First(&placeholder, "mail = ?", mail)
+		if placeholder.ID != 0 {
+			logrus.WithField("mail", mail).Debugln("Account with that mail already exists")
+			return nil, ErrAlreadyExists
+		}
+	}
+
+	acc := Account{
+		Name:     name,
+		Mail:     mail,
+		Password: passwordHash,
+		Approved: false,
+	}
+	logrus.WithField("name", name).Infoln("Creating new account")
+	res := s.db.Create(&acc)
+	if res.Error != nil {
+		return nil, fmt.Errorf("failed to insert new account %s: %w", name, res.Error)
+	}
+	return &acc, nil
+}
+
 // Section authboss
 
 func (a *Account) PutPID(pid string) {
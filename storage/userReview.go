@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Get all accounts waiting for approval, oldest first
+func (s *Storage) GetPendingAccounts() ([]Account, error) {
+	accounts := []Account{}
+	res := s.db.Where("approved = ? AND rejected = ?", false, false).
+		Order("created_at").
+		Find(&accounts)
+	if res.Error != nil {
+		return nil, fmt.Errorf("failed to get pending accounts: %w", res.Error)
+	}
+	return accounts, nil
+}
+
+// Approve an account, allowing it to publish plugins
+// Returns ErrUnauthorised if the given account isn't allowed to approve accounts
+func (s *Storage) ApproveAccount(accountID uint, by *Account) error {
+	if by == nil || !by.CanApproveUsers {
+		return ErrUnauthorised
+	}
+	return s.reviewAccount(accountID, by.ID, true, "")
+}
+
+// Reject an account
+// Returns ErrUnauthorised if the given account isn't allowed to approve accounts
+func (s *Storage) RejectAccount(accountID uint, by *Account, reason string) error {
+	if by == nil || !by.CanApproveUsers {
+		return ErrUnauthorised
+	}
+	return s.reviewAccount(accountID, by.ID, false, reason)
+}
+
+func (s *Storage) reviewAccount(accountID, byID uint, approve bool, reason string) error {
+	acc, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	res := s.db.Model(acc).Updates(map[string]any{
+		"approved":         approve,
+		"rejected":         !approve,
+		"rejection_reason": reason,
+		"reviewed_by_id":   byID,
+		"reviewed_at":      &now,
+	})
+	if res.Error != nil {
+		return fmt.Errorf("failed to update review status of account %d: %w", accountID, res.Error)
+	}
+	logrus.WithFields(logrus.Fields{
+		"accountID":   accountID,
+		"moderatorID": byID,
+		"approved":    approve,
+		"reason":      reason,
+	}).Infoln("Account reviewed")
+	return nil
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/mstarongithub/mk-plugin-repo/aiscript"
+)
+
+// Lint the code of versions uploaded before it was linted on upload
+func backfillLintFindings(db *gorm.DB) error {
+	versions := []PluginVersion{}
+	res := db.Unscoped().Where("lint_findings IS NULL").Find(&versions)
+	if res.Error != nil {
+		return fmt.Errorf("failed to get versions without lint findings: %w", res.Error)
+	}
+	if len(versions) > 0 {
+		logrus.WithField("amount", len(versions)).Infoln("Linting code of old plugin versions")
+	}
+	for _, version := range versions {
+		// Malformed metadata was rejected on upload, so nothing is lost by ignoring it here
+		meta, _ := aiscript.ParseMetadata(version.Code)
+		findings, err := json.Marshal(aiscript.Lint(version.Code, meta))
+		if err != nil {
+			return fmt.Errorf("failed to encode lint findings: %w", err)
+		}
+		err = db.Exec(
+			"UPDATE plugin_versions SET lint_findings = ? WHERE id = ?",
+			string(findings),
+			version.ID,
+		).Error
+		if err != nil {
+			return fmt.Errorf("failed to store lint findings of version %d: %w", version.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Get all versions held for review because they request more permissions, oldest first
+func (storage *Storage) GetHeldVersions() ([]PluginVersion, error) {
+	versions := []PluginVersion{}
+	res := storage.db.Where("held_for_review = ?", true).Order("created_at ASC").Find(&versions)
+	if res.Error != nil {
+		return nil, fmt.Errorf("failed to get versions held for review: %w", res.Error)
+	}
+	return versions, nil
+}
+
+// Approve a version held for review, making it the current version of its plugin
+// if it is the highest stable version
+// Returns ErrUnauthorised if the given account isn't allowed to approve plugins or this version
+// and ErrVersionNotFound if there is no such version waiting for review
+func (storage *Storage) ApproveVersion(pluginID uint, versionName string, by *Account) error {
+	version, err := storage.getHeldVersion(pluginID, versionName, by)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	res := storage.db.Model(version).Updates(map[string]any{
+		"held_for_review": false,
+		"reviewed_by_id":  by.ID,
+		"reviewed_at":     &now,
+	})
+	if res.Error != nil {
+		return fmt.Errorf("failed to approve version: %w", res.Error)
+	}
+	logrus.WithFields(logrus.Fields{
+		"pluginID":    pluginID,
+		"versionName": versionName,
+		"moderatorID": by.ID,
+	}).Infoln("Held version approved")
+	_, err = storage.PushNewPluginVersion(pluginID, versionName)
+	return err
+}
+
+// Reject a version held for review. The version gets hidden and the reason is shown to the plugin's maintainers
+// Returns ErrUnauthorised if the given account isn't allowed to approve plugins or this version
+// and ErrVersionNotFound if there is no such version waiting for review
+func (storage *Storage) RejectVersion(pluginID uint, versionName string, by *Account, reason string) error {
+	version, err := storage.getHeldVersion(pluginID, versionName, by)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	res := storage.db.Model(version).Updates(map[string]any{
+		"held_for_review":  false,
+		"reviewed_by_id":   by.ID,
+		"reviewed_at":      &now,
+		"rejection_reason": reason,
+	})
+	if res.Error != nil {
+		return fmt.Errorf("failed to reject version: %w", res.Error)
+	}
+	logrus.WithFields(logrus.Fields{
+		"pluginID":    pluginID,
+		"versionName": versionName,
+		"moderatorID": by.ID,
+		"reason":      reason,
+	}).Infoln("Held version rejected")
+	return storage.HideVersion(pluginID, versionName)
+}
+
+// Get a version held for review that the given account may review
+// Moderators can't review versions they uploaded or of plugins they author or maintain,
+// so that another moderator has to look at the new permissions
+func (storage *Storage) getHeldVersion(pluginID uint, versionName string, by *Account) (*PluginVersion, error) {
+	if by == nil || !by.CanApprovePlugins {
+		return nil, ErrUnauthorised
+	}
+	version, err := storage.TryFindVersion(pluginID, versionName)
+	if err != nil {
+		return nil, err
+	}
+	if !version.HeldForReview {
+		return nil, ErrVersionNotFound
+	}
+	plugin, err := storage.GetPluginByID(pluginID)
+	if err != nil {
+		return nil, err
+	}
+	if version.UploadedByID == by.ID || plugin.AuthorID == by.ID || slices.Contains(plugin.Maintainers, by.ID) {
+		return nil, ErrUnauthorised
+	}
+	return version, nil
+}
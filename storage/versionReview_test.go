@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/mstarongithub/mk-plugin-repo/aiscript"
+	customtypes "github.com/mstarongithub/mk-plugin-repo/storage/customTypes"
+)
+
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	store, err := NewStorage(filepath.Join(t.TempDir(), "test.db"), nil)
+	if err != nil {
+		t.Fatalf("NewStorage() error = %v", err)
+	}
+	return &store
+}
+
+func newTestAccount(t *testing.T, store *Storage, name string, moderator bool) *Account {
+	t.Helper()
+	acc := Account{Name: name, Approved: true, Confirmed: true, CanApprovePlugins: moderator}
+	if err := store.db.Create(&acc).Error; err != nil {
+		t.Fatalf("failed to create account %s: %v", name, err)
+	}
+	return &acc
+}
+
+// Create an approved plugin whose first version requests the given permissions
+func newTestPlugin(t *testing.T, store *Storage, author *Account, permissions ...string) *Plugin {
+	t.Helper()
+	plugin, err := store.NewPlugin(
+		"Test",
+		author.ID,
+		"1.0.0",
+		"",
+		"",
+		nil,
+		customtypes.PLUGIN_TYPE_PLUGIN,
+		"### { version: \"1.0.0\" }",
+		"0.19.0",
+		&aiscript.Metadata{Permissions: permissions},
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("NewPlugin() error = %v", err)
+	}
+	if err = store.db.Model(plugin).Update("approved", true).Error; err != nil {
+		t.Fatalf("failed to approve plugin: %v", err)
+	}
+	return plugin
+}
+
+func TestHeldVersionBecomesCurrentWhenApproved(t *testing.T) {
+	store := newTestStorage(t)
+	author := newTestAccount(t, store, "author", false)
+	moderator := newTestAccount(t, store, "moderator", true)
+	plugin := newTestPlugin(t, store, author, "read:account")
+
+	// Requesting the same permissions publishes right away
+	version, err := store.NewVersion(plugin.ID, author.ID, "1.1.0", "### {}", "0.19.0", "", &aiscript.Metadata{
+		Permissions: []string{"read:account"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewVersion() error = %v", err)
+	}
+	if version.HeldForReview {
+		t.Fatalf("version without new permissions is held for review")
+	}
+
+	version, err = store.NewVersion(plugin.ID, author.ID, "1.2.0", "### {}", "0.19.0", "", &aiscript.Metadata{
+		Permissions: []string{"read:account", "write:notes"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewVersion() error = %v", err)
+	}
+	if !version.HeldForReview || version.UploadedByID != author.ID {
+		t.Fatalf("version = %+v, want it held for review and uploaded by the author", version)
+	}
+	if !slices.Equal(version.AddedPermissions, []string{"write:notes"}) {
+		t.Errorf("added permissions = %v, want [write:notes]", version.AddedPermissions)
+	}
+	plugin, _ = store.GetPluginByID(plugin.ID)
+	if plugin.CurrentVersion != "1.1.0" || slices.Contains(plugin.PreviousVersions, "1.2.0") {
+		t.Fatalf("held version was published: current %q, versions %v", plugin.CurrentVersion, plugin.PreviousVersions)
+	}
+	held, err := store.GetHeldVersions()
+	if err != nil || len(held) != 1 || held[0].Version != "1.2.0" {
+		t.Fatalf("GetHeldVersions() = %v, %v, want only 1.2.0", held, err)
+	}
+
+	if err = store.ApproveVersion(plugin.ID, "1.2.0", author); !errors.Is(err, ErrUnauthorised) {
+		t.Errorf("ApproveVersion() by the author = %v, want ErrUnauthorised", err)
+	}
+	if err = store.ApproveVersion(plugin.ID, "1.2.0", moderator); err != nil {
+		t.Fatalf("ApproveVersion() error = %v", err)
+	}
+
+	plugin, _ = store.GetPluginByID(plugin.ID)
+	if plugin.CurrentVersion != "1.2.0" {
+		t.Errorf("current version = %q, want 1.2.0", plugin.CurrentVersion)
+	}
+	if !slices.Equal(plugin.Permissions, []string{"read:account", "write:notes"}) {
+		t.Errorf("plugin permissions = %v, want those of 1.2.0", plugin.Permissions)
+	}
+	approved, _ := store.TryFindVersion(plugin.ID, "1.2.0")
+	if approved.HeldForReview || approved.ReviewedByID != moderator.ID || approved.ReviewedAt == nil {
+		t.Errorf("approved version = %+v, want it reviewed by the moderator", approved)
+	}
+	if held, _ = store.GetHeldVersions(); len(held) != 0 {
+		t.Errorf("GetHeldVersions() = %v after approving, want none", held)
+	}
+	if err = store.ApproveVersion(plugin.ID, "1.2.0", moderator); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("approving again = %v, want ErrVersionNotFound", err)
+	}
+}
+
+func TestModeratorsCantReviewTheirOwnVersions(t *testing.T) {
+	store := newTestStorage(t)
+	author := newTestAccount(t, store, "author", true)
+	maintainer := newTestAccount(t, store, "maintainer", true)
+	uploader := newTestAccount(t, store, "uploader", true)
+	other := newTestAccount(t, store, "other", true)
+	plugin := newTestPlugin(t, store, author)
+	plugin.Maintainers = append(plugin.Maintainers, maintainer.ID)
+	if err := store.UpdatePlugin(plugin); err != nil {
+		t.Fatalf("UpdatePlugin() error = %v", err)
+	}
+	// Moderators can manage every plugin, so one may upload a version without maintaining it
+	_, err := store.NewVersion(plugin.ID, uploader.ID, "1.1.0", "### {}", "0.19.0", "", &aiscript.Metadata{
+		Permissions: []string{"write:notes"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewVersion() error = %v", err)
+	}
+
+	for _, acc := range []*Account{author, maintainer, uploader} {
+		if err = store.ApproveVersion(plugin.ID, "1.1.0", acc); !errors.Is(err, ErrUnauthorised) {
+			t.Errorf("ApproveVersion() by %s = %v, want ErrUnauthorised", acc.Name, err)
+		}
+		if err = store.RejectVersion(plugin.ID, "1.1.0", acc, "no"); !errors.Is(err, ErrUnauthorised) {
+			t.Errorf("RejectVersion() by %s = %v, want ErrUnauthorised", acc.Name, err)
+		}
+	}
+	if err = store.RejectVersion(plugin.ID, "1.1.0", other, "asks for too much"); err != nil {
+		t.Fatalf("RejectVersion() by another moderator error = %v", err)
+	}
+	plugin, _ = store.GetPluginByID(plugin.ID)
+	if plugin.CurrentVersion != "1.0.0" {
+		t.Errorf("current version = %q after rejecting, want 1.0.0", plugin.CurrentVersion)
+	}
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrVersionHeldForReview = errors.New("version is held for review")
+
+// Yank a version on behalf of the given account
+// Yanked versions keep their data and stay fetchable, but are removed from the plugin's versions
+// and never become current in any channel. Yanking an already yanked version updates the reason
+// Returns ErrUnauthorised if the account isn't allowed to manage the plugin
+// and ErrVersionHeldForReview if the version hasn't been published yet
+func (storage *Storage) YankVersion(pluginID uint, versionName string, by *Account, reason string) error {
+	plugin, version, err := storage.getManagedVersion(pluginID, versionName, by)
+	if err != nil {
+		return err
+	}
+	if version.HeldForReview {
+		return ErrVersionHeldForReview
+	}
+	now := time.Now()
+	res := storage.db.Model(version).Updates(map[string]any{
+		"yanked":       true,
+		"yanked_by_id": by.ID,
+		"yanked_at":    &now,
+		"yank_reason":  reason,
+	})
+	if res.Error != nil {
+		return fmt.Errorf("failed to yank version: %w", res.Error)
+	}
+	logrus.WithFields(logrus.Fields{
+		"pluginID":    pluginID,
+		"versionName": versionName,
+		"accountID":   by.ID,
+		"reason":      reason,
+	}).Infoln("Version yanked")
+	plugin.PreviousVersions = slices.DeleteFunc(
+		plugin.PreviousVersions,
+		func(name string) bool { return name == versionName },
+	)
+	return storage.refreshCurrentVersion(plugin)
+}
+
+// Undo yanking a version on behalf of the given account. It may become current again
+// Does nothing if the version isn't yanked
+// Returns ErrUnauthorised if the account isn't allowed to manage the plugin
+func (storage *Storage) UnyankVersion(pluginID uint, versionName string, by *Account) error {
+	plugin, version, err := storage.getManagedVersion(pluginID, versionName, by)
+	if err != nil {
+		return err
+	}
+	if !version.Yanked {
+		return nil
+	}
+	res := storage.db.Model(version).Updates(map[string]any{
+		"yanked":       false,
+		"yanked_by_id": 0,
+		"yanked_at":    nil,
+		"yank_reason":  "",
+	})
+	if res.Error != nil {
+		return fmt.Errorf("failed to un-yank version: %w", res.Error)
+	}
+	logrus.WithFields(logrus.Fields{
+		"pluginID":    pluginID,
+		"versionName": versionName,
+		"accountID":   by.ID,
+	}).Infoln("Version un-yanked")
+	if !slices.Contains(plugin.PreviousVersions, versionName) {
+		plugin.PreviousVersions = append(plugin.PreviousVersions, versionName)
+	}
+	return storage.refreshCurrentVersion(plugin)
+}
+
+func (storage *Storage) getManagedVersion(
+	pluginID uint,
+	versionName string,
+	by *Account,
+) (*Plugin, *PluginVersion, error) {
+	plugin, err := storage.GetPluginByID(pluginID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !plugin.CanBeManagedBy(by) {
+		return nil, nil, ErrUnauthorised
+	}
+	version, err := storage.TryFindVersion(pluginID, versionName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plugin, version, nil
+}
+
+// Remove versions that were hidden before yanking existed from the version lists of their plugins
+// They used to stay listed and possibly current after being deleted
+func (storage *Storage) removeDanglingVersions() error {
+	plugins := []Plugin{}
+	res := storage.db.Where(
+		"EXISTS (SELECT 1 FROM json_each(plugins.previous_versions) WHERE json_each.value NOT IN " +
+			"(SELECT version FROM plugin_versions WHERE plugin_versions.plugin_id = plugins.id" +
+			" AND plugin_versions.deleted_at IS NULL))",
+	).Find(&plugins)
+	if res.Error != nil {
+		return fmt.Errorf("failed to find plugins listing deleted versions: %w", res.Error)
+	}
+	for _, plugin := range plugins {
+		existing := []string{}
+		res = storage.db.Model(&PluginVersion{}).
+			Where("plugin_id = ?", plugin.ID).
+			Pluck("version", &existing)
+		if res.Error != nil {
+			return fmt.Errorf("failed to get versions of plugin %d: %w", plugin.ID, res.Error)
+		}
+		plugin.PreviousVersions = slices.DeleteFunc(
+			plugin.PreviousVersions,
+			func(name string) bool { return !slices.Contains(existing, name) },
+		)
+		logrus.WithField("pluginID", plugin.ID).Infoln("Removing deleted versions from plugin")
+		if err := storage.refreshCurrentVersion(&plugin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package util
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"time"
 
@@ -10,17 +12,28 @@ import (
 
 const TOKEN_ISSUER = "mk-plugin-repo-api"
 
+// How long a token created via CreateToken stays valid
+const TOKEN_LIFETIME = time.Hour * 24
+
 var secretKey = []byte("some super secret key that no one will ever guess")
 
 var ErrInvalidToken = fmt.Errorf("invalid token")
 
 func CreateToken(username string) (string, error) {
+	// Random token id so that two logins within the same second don't produce the same token
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
+	}
+	now := time.Now()
 	token := jwt.NewWithClaims(
 		jwt.SigningMethodHS512,
 		jwt.MapClaims{
 			"iss": TOKEN_ISSUER,
 			"sub": username,
-			"exp": time.Now().Add(time.Hour * 24).Unix(),
+			"iat": now.Unix(),
+			"exp": now.Add(TOKEN_LIFETIME).Unix(),
+			"jti": hex.EncodeToString(jti),
 		},
 	)
 	tokenString, err := token.SignedString(secretKey)
@@ -31,11 +44,50 @@ func CreateToken(username string) (string, error) {
 }
 
 func VerifyToken(tokenString string) (bool, error) {
-	token, err := jwt.Parse(tokenString, func(*jwt.Token) (interface{}, error) {
-		return secretKey, nil
-	})
+	_, err := parseToken(tokenString)
 	if err != nil {
-		return false, fmt.Errorf("failed to parse string as token: %w", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// Verify a token and return the subject (username) it was issued for
+func GetTokenSubject(tokenString string) (string, error) {
+	token, err := parseToken(tokenString)
+	if err != nil {
+		return "", err
+	}
+	subject, err := token.Claims.GetSubject()
+	if err != nil {
+		return "", fmt.Errorf("failed to get subject from token: %w", err)
+	}
+	return subject, nil
+}
+
+// Get the time a token expires at. Does not verify the token
+func GetTokenExpiry(tokenString string) (time.Time, error) {
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse string as token: %w", err)
+	}
+	exp, err := token.Claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return time.Time{}, ErrInvalidToken
+	}
+	return exp.Time, nil
+}
+
+func parseToken(tokenString string) (*jwt.Token, error) {
+	token, err := jwt.Parse(
+		tokenString,
+		func(*jwt.Token) (interface{}, error) {
+			return secretKey, nil
+		},
+		jwt.WithIssuer(TOKEN_ISSUER),
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS512.Alg()}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse string as token: %w", err)
 	}
 
 	logrus.WithFields(logrus.Fields{
@@ -45,9 +97,9 @@ func VerifyToken(tokenString string) (bool, error) {
 	}).Debugln("Verifying token")
 
 	if !token.Valid {
-		return false, ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
-	return true, nil
+	return token, nil
 }
 
 func resToString(x any, e error) string {